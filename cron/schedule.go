@@ -0,0 +1,266 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule yields the activation times of a task.
+type Schedule interface {
+	// Next returns the first activation strictly after t, or the zero time
+	// if there is none within the next five years.
+	Next(t time.Time) time.Time
+}
+
+// ===============================
+// Parser
+// ===============================
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// Parse parses a standard five-field cron expression
+// ("minute hour day-of-month month day-of-week"), one of the @yearly, @monthly,
+// @weekly, @daily, @hourly descriptors, or "@every <duration>". Times are
+// evaluated in loc. @every ticks are aligned to the Unix epoch so that all
+// replicas agree on them.
+//
+// Around DST changes in loc, a wall-clock time that is skipped does not run
+// that day, and one that repeats runs twice, once for each instant it names.
+// @every schedules are unaffected.
+func Parse(expr string, loc *time.Location) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if d, ok := strings.CutPrefix(expr, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil {
+			return nil, fmt.Errorf("cron: %q: %w", expr, err)
+		}
+		if every < time.Second {
+			return nil, fmt.Errorf("cron: %q: interval must be at least 1s", expr)
+		}
+		return everySchedule(every), nil
+	}
+	if spec, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = spec
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("cron: %q: expected 5 fields, got %d", expr, len(parts))
+	}
+
+	s := &cronSchedule{loc: loc}
+	if s.loc == nil {
+		s.loc = time.UTC
+	}
+
+	var err error
+	if s.minute, err = parseField(parts[0], minuteField); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(parts[1], hourField); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(parts[2], domField); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(parts[3], monthField); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(parts[4], dowField); err != nil {
+		return nil, err
+	}
+	// 7 is an alias for Sunday.
+	if s.dow.has(7) {
+		s.dow |= 1
+	}
+	s.domAny = isWildcard(parts[2])
+	s.dowAny = isWildcard(parts[4])
+
+	return s, nil
+}
+
+func isWildcard(s string) bool {
+	return s == "*" || s == "?"
+}
+
+type bits uint64
+
+func (b bits) has(i int) bool { return b&(1<<uint(i)) != 0 }
+
+func parseField(expr string, f field) (bits, error) {
+	var b bits
+	for _, part := range strings.Split(expr, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("cron: invalid step %q in %s field", stepStr, f.name)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case isWildcard(rng):
+		case strings.Contains(rng, "-"):
+			from, to, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(from); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(to); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !hasStep {
+				hi = v
+			}
+		}
+
+		if lo > hi {
+			return 0, fmt.Errorf("cron: invalid range %q in %s field", rng, f.name)
+		}
+		for i := lo; i <= hi; i += step {
+			b |= 1 << uint(i)
+		}
+	}
+
+	return b, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("cron: invalid value %q in %s field", s, f.name)
+	}
+	return v, nil
+}
+
+// ===============================
+// Schedules
+// ===============================
+
+type cronSchedule struct {
+	minute, hour, dom, month, dow bits
+	domAny, dowAny                bool
+	loc                           *time.Location
+}
+
+// Next steps through wall-clock fields in loc. Hours and minutes advance in
+// absolute time, so around DST changes a wall time that is skipped never
+// matches and one that repeats matches twice.
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	yearLimit := t.Year() + 5
+
+wrap:
+	for t.Year() <= yearLimit {
+		for !s.month.has(int(t.Month())) {
+			t = midnight(t.Year(), t.Month()+1, 1, s.loc)
+			if t.Month() == time.January {
+				continue wrap
+			}
+		}
+		for !s.dayMatches(t) {
+			t = midnight(t.Year(), t.Month(), t.Day()+1, s.loc)
+			if t.Day() == 1 {
+				continue wrap
+			}
+		}
+		for !s.hour.has(t.Hour()) {
+			day := t.Day()
+			t = t.Add(-time.Duration(t.Minute()) * time.Minute).Add(time.Hour)
+			if t.Day() != day {
+				continue wrap
+			}
+		}
+		for !s.minute.has(t.Minute()) {
+			t = t.Add(time.Minute)
+			if t.Minute() == 0 {
+				continue wrap
+			}
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// midnight returns the start of the given day in loc. When a DST change
+// skips midnight, time.Date may resolve it to the previous evening; the day
+// then starts an hour later.
+func midnight(year int, month time.Month, day int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	if t.Hour() == 23 {
+		t = t.Add(time.Hour)
+	}
+	return t
+}
+
+// dayMatches follows cron: when both day fields are restricted, either one
+// matching is enough.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom.has(t.Day())
+	dow := s.dow.has(int(t.Weekday()))
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	d := int64(e)
+	n := t.UnixNano()
+	r := n % d
+	if r < 0 {
+		r += d
+	}
+	return time.Unix(0, n-r+d).In(t.Location())
+}
@@ -0,0 +1,148 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, expr string, loc *time.Location) Schedule {
+	t.Helper()
+	s, err := Parse(expr, loc)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", expr, err)
+	}
+	return s
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+		"@every 500ms",
+		"@every soon",
+	} {
+		if _, err := Parse(expr, time.UTC); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// 2025-01-01 is a Wednesday.
+	from := time.Date(2025, 1, 1, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC)},
+		{"30 8 * * *", time.Date(2025, 1, 2, 8, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * mon", time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"@HOURLY", time.Date(2025, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := mustParse(t, tt.expr, time.UTC).Next(from); !got.Equal(tt.want) {
+			t.Errorf("%q: Next(%s) = %s, want %s", tt.expr, from, got, tt.want)
+		}
+	}
+}
+
+func TestNextDayOfMonthOrDayOfWeek(t *testing.T) {
+	// Both day fields restricted: the 13th or any Friday.
+	s := mustParse(t, "0 0 13 * fri", time.UTC)
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := []time.Time{
+		time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC),
+	}
+	for _, w := range want {
+		from = s.Next(from)
+		if !from.Equal(w) {
+			t.Fatalf("Next = %s, want %s", from, w)
+		}
+	}
+
+	// Only one restricted: the wildcard does not widen the match.
+	s = mustParse(t, "0 0 * * fri", time.UTC)
+	if got, want := s.Next(time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)), time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next = %s, want %s", got, want)
+	}
+}
+
+func TestNextAcrossDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// 2025-03-09 02:00 EST jumps to 03:00 EDT: 02:30 does not exist that day.
+	s := mustParse(t, "30 2 * * *", ny)
+	got := s.Next(time.Date(2025, 3, 9, 0, 0, 0, 0, ny))
+	if want := time.Date(2025, 3, 10, 2, 30, 0, 0, ny); !got.Equal(want) {
+		t.Errorf("spring forward: Next = %s, want %s", got, want)
+	}
+
+	s = mustParse(t, "0 * * * *", ny)
+	got = s.Next(time.Date(2025, 3, 9, 1, 30, 0, 0, ny))
+	if want := time.Date(2025, 3, 9, 3, 0, 0, 0, ny); !got.Equal(want) {
+		t.Errorf("spring forward hourly: Next = %s, want %s", got, want)
+	}
+
+	// 2025-11-02 02:00 EDT falls back to 01:00 EST: 01:30 happens twice.
+	s = mustParse(t, "30 1 * * *", ny)
+	first := s.Next(time.Date(2025, 11, 2, 0, 0, 0, 0, ny))
+	second := s.Next(first)
+	if want := time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC); !first.Equal(want) {
+		t.Errorf("fall back: first = %s, want %s", first, want)
+	}
+	if want := time.Date(2025, 11, 2, 6, 30, 0, 0, time.UTC); !second.Equal(want) {
+		t.Errorf("fall back: second = %s, want %s", second, want)
+	}
+}
+
+func TestNextSkippedMidnight(t *testing.T) {
+	// Santiago moved clocks from 00:00 to 01:00 on 2024-09-08.
+	scl, err := time.LoadLocation("America/Santiago")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	s := mustParse(t, "0 12 8 9 *", scl)
+	got := s.Next(time.Date(2024, 9, 7, 13, 0, 0, 0, scl))
+	if want := time.Date(2024, 9, 8, 12, 0, 0, 0, scl); !got.Equal(want) {
+		t.Errorf("Next = %s, want %s", got, want)
+	}
+}
+
+func TestEveryAlignedToUnixEpoch(t *testing.T) {
+	s := mustParse(t, "@every 7m", time.UTC)
+	from := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	got := s.Next(from)
+
+	if got.Unix()%(7*60) != 0 {
+		t.Errorf("Next = %s, not a multiple of 7m since the epoch", got)
+	}
+	if !got.After(from) || got.Sub(from) > 7*time.Minute {
+		t.Errorf("Next(%s) = %s, want within the next 7m", from, got)
+	}
+	if next := s.Next(got); next.Sub(got) != 7*time.Minute {
+		t.Errorf("Next(%s) = %s, want 7m later", got, next)
+	}
+}
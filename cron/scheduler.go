@@ -0,0 +1,308 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+// Schema creates the table that holds the per-task lease and the outcome of
+// the last run.
+const Schema = `
+CREATE TABLE IF NOT EXISTS cron_tasks (
+	name              TEXT PRIMARY KEY,
+	last_scheduled_at TIMESTAMPTZ NOT NULL,
+	runner            TEXT NOT NULL,
+	started_at        TIMESTAMPTZ NOT NULL,
+	finished_at       TIMESTAMPTZ,
+	duration_ms       BIGINT,
+	last_error        TEXT
+);
+`
+
+const _maxCatchUpRuns = 100
+
+// CatchUp decides what happens to ticks missed while no replica was running.
+type CatchUp int
+
+const (
+	// CatchUpSkip ignores missed ticks.
+	CatchUpSkip CatchUp = iota
+	// CatchUpOnce runs once for the most recent missed tick.
+	CatchUpOnce
+	// CatchUpAll runs every missed tick in order, up to 100 of them.
+	CatchUpAll
+)
+
+type TaskOption func(*task)
+
+// Jitter delays every run by a random duration in [0, d).
+func Jitter(d time.Duration) TaskOption {
+	return func(t *task) {
+		t.jitter = d
+	}
+}
+
+func WithCatchUp(policy CatchUp) TaskOption {
+	return func(t *task) {
+		t.catchUp = policy
+	}
+}
+
+type Option func(*Scheduler)
+
+// InLocation sets the time zone cron expressions are evaluated in. The
+// default is UTC; all replicas must use the same one.
+func InLocation(loc *time.Location) Option {
+	return func(s *Scheduler) {
+		s.loc = loc
+	}
+}
+
+type task struct {
+	name     string
+	schedule Schedule
+	fn       func(ctx context.Context) error
+	jitter   time.Duration
+	catchUp  CatchUp
+}
+
+// Scheduler runs registered tasks on their cron schedule. Every replica runs
+// a Scheduler; for each tick exactly one of them wins the lease in the
+// cron_tasks table and runs the task.
+//
+// Ticks are instants, so DST follows Parse: a task at a wall time the clock
+// skips does not run that day, and one at a repeated wall time runs twice,
+// each tick claimed on its own.
+type Scheduler struct {
+	u      tx.Transactor
+	loc    *time.Location
+	runner string
+
+	mu    sync.Mutex
+	tasks map[string]*task
+}
+
+func NewScheduler(u tx.Transactor, opts ...Option) *Scheduler {
+	host, _ := os.Hostname()
+	s := &Scheduler{
+		u:      u,
+		loc:    time.UTC,
+		runner: fmt.Sprintf("%s-%d", host, os.Getpid()),
+		tasks:  make(map[string]*task),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Register adds a task. It must be called before Run.
+func (s *Scheduler) Register(name, expr string, fn func(ctx context.Context) error, opts ...TaskOption) error {
+	schedule, err := Parse(expr, s.loc)
+	if err != nil {
+		return err
+	}
+
+	t := &task{name: name, schedule: schedule, fn: fn}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tasks[name]; ok {
+		return fmt.Errorf("cron: task %q already registered", name)
+	}
+	s.tasks[name] = t
+
+	return nil
+}
+
+// Run schedules all tasks until ctx is done and waits for running tasks to
+// return.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	tasks := make([]*task, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		tasks = append(tasks, t)
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, t := range tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, t)
+		}()
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+func (s *Scheduler) loop(ctx context.Context, t *task) {
+	if err := s.catchUp(ctx, t); err != nil && ctx.Err() == nil {
+		slog.ErrorContext(ctx, "cron: catch-up failed", "task", t.name, "error", err)
+	}
+
+	for {
+		tick := t.schedule.Next(time.Now())
+		if tick.IsZero() {
+			slog.WarnContext(ctx, "cron: task has no future runs", "task", t.name)
+			return
+		}
+
+		delay := time.Until(tick)
+		if t.jitter > 0 {
+			delay += rand.N(t.jitter)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		s.tryRun(ctx, t, tick)
+	}
+}
+
+func (s *Scheduler) catchUp(ctx context.Context, t *task) error {
+	if t.catchUp == CatchUpSkip {
+		return nil
+	}
+
+	var last time.Time
+	err := tx.WithinTx(ctx, s.u, func(ctx context.Context) error {
+		db := tx.TxFrom(ctx)
+		if db == nil {
+			return tx.ErrNoTx
+		}
+
+		return db.QueryRow(ctx,
+			"SELECT last_scheduled_at FROM cron_tasks WHERE name = $1", t.name).Scan(&last)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Never ran: nothing was missed.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var missed []time.Time
+	for tick := t.schedule.Next(last); !tick.IsZero() && !tick.After(now); tick = t.schedule.Next(tick) {
+		missed = append(missed, tick)
+		if t.catchUp == CatchUpOnce && len(missed) > 1 {
+			missed = missed[1:]
+		}
+		if len(missed) >= _maxCatchUpRuns {
+			break
+		}
+	}
+
+	for _, tick := range missed {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.tryRun(ctx, t, tick)
+	}
+
+	return nil
+}
+
+// tryRun runs t for tick if this replica wins the lease for it.
+func (s *Scheduler) tryRun(ctx context.Context, t *task, tick time.Time) {
+	won, err := s.claim(ctx, t, tick)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.ErrorContext(ctx, "cron: claim failed", "task", t.name, "tick", tick, "error", err)
+		}
+		return
+	}
+	if !won {
+		return
+	}
+
+	started := time.Now()
+	runErr := runSafely(ctx, t.fn)
+	duration := time.Since(started)
+
+	if runErr != nil {
+		slog.ErrorContext(ctx, "cron: task failed", "task", t.name, "tick", tick, "duration", duration, "error", runErr)
+	}
+	if err := s.record(context.WithoutCancel(ctx), t, tick, duration, runErr); err != nil {
+		slog.ErrorContext(ctx, "cron: record run failed", "task", t.name, "error", err)
+	}
+}
+
+func runSafely(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+// claim moves the task's lease to tick. The row lock taken by the upsert
+// serializes replicas, and the WHERE clause lets only the first one through.
+func (s *Scheduler) claim(ctx context.Context, t *task, tick time.Time) (bool, error) {
+	return tx.WithinTxR(ctx, s.u, func(ctx context.Context) (bool, error) {
+		db := tx.TxFrom(ctx)
+		if db == nil {
+			return false, tx.ErrNoTx
+		}
+
+		tag, err := db.Exec(ctx, `
+			INSERT INTO cron_tasks (name, last_scheduled_at, runner, started_at)
+			VALUES ($1, $2, $3, now())
+			ON CONFLICT (name) DO UPDATE
+			SET last_scheduled_at = EXCLUDED.last_scheduled_at,
+				runner = EXCLUDED.runner,
+				started_at = EXCLUDED.started_at,
+				finished_at = NULL,
+				duration_ms = NULL,
+				last_error = NULL
+			WHERE cron_tasks.last_scheduled_at < EXCLUDED.last_scheduled_at`,
+			t.name, tick, s.runner)
+		if err != nil {
+			return false, err
+		}
+		return tag.RowsAffected() == 1, nil
+	})
+}
+
+func (s *Scheduler) record(ctx context.Context, t *task, tick time.Time, duration time.Duration, runErr error) error {
+	var errText *string
+	if runErr != nil {
+		msg := runErr.Error()
+		errText = &msg
+	}
+
+	return tx.WithinTx(ctx, s.u, func(ctx context.Context) error {
+		db := tx.TxFrom(ctx)
+		if db == nil {
+			return tx.ErrNoTx
+		}
+
+		_, err := db.Exec(ctx, `
+			UPDATE cron_tasks
+			SET finished_at = now(), duration_ms = $3, last_error = $4
+			WHERE name = $1 AND last_scheduled_at = $2 AND runner = $5`,
+			t.name, tick, duration.Milliseconds(), errText, s.runner)
+		return err
+	})
+}
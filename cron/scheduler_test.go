@@ -0,0 +1,185 @@
+package cron
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nghiatrann0502/kyra-kit/postgres/pgtest"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+// ticks is a Schedule with fixed activation times, in order.
+type ticks []time.Time
+
+func (s ticks) Next(t time.Time) time.Time {
+	for _, tick := range s {
+		if tick.After(t) {
+			return tick
+		}
+	}
+	return time.Time{}
+}
+
+var base = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestScheduler(m *pgtest.Mock) *Scheduler {
+	s := NewScheduler(tx.NewUnitOfWord(m))
+	s.runner = "replica-1"
+	return s
+}
+
+// expectClaim expects the lease upsert for tick, won or lost.
+func expectClaim(m *pgtest.Mock, s *Scheduler, name string, tick time.Time, won bool) {
+	tag := "INSERT 0 0"
+	if won {
+		tag = "INSERT 0 1"
+	}
+	m.ExpectBegin()
+	m.ExpectExecRegexp(`(?s)INSERT INTO cron_tasks .*\sWHERE cron_tasks.last_scheduled_at < EXCLUDED.last_scheduled_at`).
+		WithArgs(name, tick, s.runner).
+		WillReturnResult(tag)
+	m.ExpectCommit()
+}
+
+func expectRecord(m *pgtest.Mock, s *Scheduler, name string, tick time.Time, errText *string) {
+	m.ExpectBegin()
+	m.ExpectExecRegexp(`(?s)UPDATE cron_tasks\s+SET finished_at = now\(\)`).
+		WithArgs(name, tick, pgtest.AnyArg(), errText, s.runner).
+		WillReturnResult("UPDATE 1")
+	m.ExpectCommit()
+}
+
+func TestTryRunWinsLease(t *testing.T) {
+	m := pgtest.New(t)
+	s := newTestScheduler(m)
+	tick := base.Add(time.Hour)
+	expectClaim(m, s, "report", tick, true)
+	expectRecord(m, s, "report", tick, nil)
+
+	runs := 0
+	s.tryRun(context.Background(), &task{name: "report", fn: func(context.Context) error {
+		runs++
+		return nil
+	}}, tick)
+	if runs != 1 {
+		t.Errorf("runs = %d, want 1", runs)
+	}
+}
+
+func TestTryRunLosesLease(t *testing.T) {
+	m := pgtest.New(t)
+	s := newTestScheduler(m)
+	tick := base.Add(time.Hour)
+	expectClaim(m, s, "report", tick, false)
+
+	s.tryRun(context.Background(), &task{name: "report", fn: func(context.Context) error {
+		t.Error("task ran without the lease")
+		return nil
+	}}, tick)
+}
+
+func TestTryRunRecordsFailure(t *testing.T) {
+	m := pgtest.New(t)
+	s := newTestScheduler(m)
+	tick := base.Add(time.Hour)
+	msg := "panic: boom"
+	expectClaim(m, s, "report", tick, true)
+	expectRecord(m, s, "report", tick, &msg)
+
+	s.tryRun(context.Background(), &task{name: "report", fn: func(context.Context) error {
+		panic("boom")
+	}}, tick)
+}
+
+func TestCatchUp(t *testing.T) {
+	missed := ticks{base.Add(time.Hour), base.Add(2 * time.Hour), base.Add(3 * time.Hour), time.Now().Add(time.Hour)}
+	tests := []struct {
+		policy CatchUp
+		want   []time.Time
+	}{
+		{CatchUpSkip, nil},
+		{CatchUpOnce, missed[2:3]},
+		{CatchUpAll, missed[:3]},
+	}
+	for _, tt := range tests {
+		t.Run(fmtPolicy(tt.policy), func(t *testing.T) {
+			m := pgtest.New(t)
+			s := newTestScheduler(m)
+			if tt.policy != CatchUpSkip {
+				m.ExpectBegin()
+				m.ExpectQuery("SELECT last_scheduled_at FROM cron_tasks WHERE name = $1").
+					WithArgs("report").
+					WillReturnRows(pgtest.NewRows("last_scheduled_at").AddRow(base))
+				m.ExpectCommit()
+			}
+			for _, tick := range tt.want {
+				expectClaim(m, s, "report", tick, true)
+				expectRecord(m, s, "report", tick, nil)
+			}
+
+			runs := 0
+			err := s.catchUp(context.Background(), &task{name: "report", schedule: missed, catchUp: tt.policy,
+				fn: func(context.Context) error {
+					runs++
+					return nil
+				}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if runs != len(tt.want) {
+				t.Errorf("ran %d times, want %d", runs, len(tt.want))
+			}
+		})
+	}
+}
+
+func fmtPolicy(p CatchUp) string {
+	return [...]string{"skip", "once", "all"}[p]
+}
+
+func TestCatchUpNeverRan(t *testing.T) {
+	m := pgtest.New(t)
+	s := newTestScheduler(m)
+	m.ExpectBegin()
+	m.ExpectQuery("SELECT last_scheduled_at FROM cron_tasks WHERE name = $1").
+		WithArgs("report").
+		WillReturnRows(pgtest.NewRows("last_scheduled_at"))
+	m.ExpectRollback()
+
+	err := s.catchUp(context.Background(), &task{name: "report", schedule: ticks{base}, catchUp: CatchUpAll,
+		fn: func(context.Context) error {
+			t.Error("task ran although it never ran before")
+			return nil
+		}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCatchUpAllIsCapped(t *testing.T) {
+	m := pgtest.New(t)
+	s := newTestScheduler(m)
+	var many ticks
+	for i := 1; i <= 2*_maxCatchUpRuns; i++ {
+		many = append(many, base.Add(time.Duration(i)*time.Minute))
+	}
+	m.ExpectBegin()
+	m.ExpectQuery("SELECT last_scheduled_at FROM cron_tasks WHERE name = $1").
+		WithArgs("report").
+		WillReturnRows(pgtest.NewRows("last_scheduled_at").AddRow(base))
+	m.ExpectCommit()
+	// The oldest ticks are claimed first; another replica won them all.
+	for _, tick := range many[:_maxCatchUpRuns] {
+		expectClaim(m, s, "report", tick, false)
+	}
+
+	err := s.catchUp(context.Background(), &task{name: "report", schedule: many, catchUp: CatchUpAll,
+		fn: func(context.Context) error {
+			t.Error("task ran without the lease")
+			return nil
+		}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -9,9 +9,11 @@ const (
 
 	ErrCodeUnauthorized ErrorCode = 2000
 
-	ErrCodeInvalidInput  ErrorCode = 4000
-	ErrCodeNotFound      ErrorCode = 4040
-	ErrCodeAlreadyExists ErrorCode = 4090
+	ErrCodeInvalidInput       ErrorCode = 4000
+	ErrCodeFailedPrecondition ErrorCode = 4001
+	ErrCodeNotFound           ErrorCode = 4040
+	ErrCodeAlreadyExists      ErrorCode = 4090
+	ErrCodeAborted            ErrorCode = 4091
 
 	ErrCodeInvalidRequest          ErrorCode = 4100
 	ErrCodeUnauthorizedClient      ErrorCode = 4101
@@ -28,6 +30,7 @@ const (
 	ErrCodeDatabase    ErrorCode = 5002
 	ErrCodeExternal    ErrorCode = 5003
 	ErrCOdeServerError ErrorCode = 5004
+	ErrCodeUnavailable ErrorCode = 5030
 )
 
 var ErrNotFound = errors.New("not found")
@@ -82,6 +82,10 @@ func Is(err, target error) bool {
 	return errors.Is(err, target)
 }
 
+func Join(errs ...error) error {
+	return errors.Join(errs...)
+}
+
 func (err *Error) Error() string {
 	if err.cause != nil {
 		return fmt.Sprintf("%d: %s: %v", err.code, err.message, err.cause)
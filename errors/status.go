@@ -0,0 +1,113 @@
+package errors
+
+import (
+	"net/http"
+	"sync"
+)
+
+// GRPCStatusCode mirrors google.golang.org/grpc/codes.Code, so a value
+// converts directly: codes.Code(errors.GRPCCode(err)).
+type GRPCStatusCode uint32
+
+const (
+	GRPCOK                 GRPCStatusCode = 0
+	GRPCCanceled           GRPCStatusCode = 1
+	GRPCUnknown            GRPCStatusCode = 2
+	GRPCInvalidArgument    GRPCStatusCode = 3
+	GRPCDeadlineExceeded   GRPCStatusCode = 4
+	GRPCNotFound           GRPCStatusCode = 5
+	GRPCAlreadyExists      GRPCStatusCode = 6
+	GRPCPermissionDenied   GRPCStatusCode = 7
+	GRPCResourceExhausted  GRPCStatusCode = 8
+	GRPCFailedPrecondition GRPCStatusCode = 9
+	GRPCAborted            GRPCStatusCode = 10
+	GRPCOutOfRange         GRPCStatusCode = 11
+	GRPCUnimplemented      GRPCStatusCode = 12
+	GRPCInternal           GRPCStatusCode = 13
+	GRPCUnavailable        GRPCStatusCode = 14
+	GRPCDataLoss           GRPCStatusCode = 15
+	GRPCUnauthenticated    GRPCStatusCode = 16
+)
+
+type statusMapping struct {
+	http int
+	grpc GRPCStatusCode
+}
+
+var (
+	statusMu sync.RWMutex
+	statuses = map[ErrorCode]statusMapping{
+		ErrCodeForbidden: {http.StatusForbidden, GRPCPermissionDenied},
+
+		ErrCodeUnauthorized: {http.StatusUnauthorized, GRPCUnauthenticated},
+
+		ErrCodeInvalidInput:       {http.StatusBadRequest, GRPCInvalidArgument},
+		ErrCodeFailedPrecondition: {http.StatusBadRequest, GRPCFailedPrecondition},
+		ErrCodeNotFound:           {http.StatusNotFound, GRPCNotFound},
+		ErrCodeAlreadyExists:      {http.StatusConflict, GRPCAlreadyExists},
+		ErrCodeAborted:            {http.StatusConflict, GRPCAborted},
+
+		ErrCodeInvalidRequest:          {http.StatusBadRequest, GRPCInvalidArgument},
+		ErrCodeUnauthorizedClient:      {http.StatusForbidden, GRPCPermissionDenied},
+		ErrCodeAccessDenined:           {http.StatusForbidden, GRPCPermissionDenied},
+		ErrCodeUnsupportedResponseType: {http.StatusBadRequest, GRPCInvalidArgument},
+		ErrCodeInvalidScope:            {http.StatusBadRequest, GRPCInvalidArgument},
+		ErrCodeTemporarilyUnavailable:  {http.StatusServiceUnavailable, GRPCUnavailable},
+		ErrCodeLoginRequired:           {http.StatusUnauthorized, GRPCUnauthenticated},
+		ErrCodeInteractionRequired:     {http.StatusUnauthorized, GRPCUnauthenticated},
+		ErrCodeInvalidGrant:            {http.StatusBadRequest, GRPCInvalidArgument},
+
+		ErrCodeUnknown:     {http.StatusInternalServerError, GRPCUnknown},
+		ErrCodeInternal:    {http.StatusInternalServerError, GRPCInternal},
+		ErrCodeDatabase:    {http.StatusInternalServerError, GRPCInternal},
+		ErrCodeExternal:    {http.StatusBadGateway, GRPCUnavailable},
+		ErrCOdeServerError: {http.StatusInternalServerError, GRPCInternal},
+		ErrCodeUnavailable: {http.StatusServiceUnavailable, GRPCUnavailable},
+	}
+)
+
+// RegisterCode maps a service's own code, or overrides the mapping of a
+// built-in one. Call it during initialization.
+func RegisterCode(code ErrorCode, httpStatus int, grpcCode GRPCStatusCode) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	statuses[code] = statusMapping{http: httpStatus, grpc: grpcCode}
+}
+
+// HTTPStatus returns the HTTP status for err: 200 for nil, 404 for
+// ErrNotFound, 500 for errors without a mapped code.
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	if m, ok := lookupStatus(err); ok {
+		return m.http
+	}
+	return http.StatusInternalServerError
+}
+
+// GRPCCode returns the gRPC code for err: OK for nil, NotFound for
+// ErrNotFound, Internal for errors without a mapped code.
+func GRPCCode(err error) GRPCStatusCode {
+	if err == nil {
+		return GRPCOK
+	}
+	if m, ok := lookupStatus(err); ok {
+		return m.grpc
+	}
+	return GRPCInternal
+}
+
+func lookupStatus(err error) (statusMapping, bool) {
+	code := GetCode(err)
+	var appErr *Error
+	if !As(err, &appErr) && Is(err, ErrNotFound) {
+		code = ErrCodeNotFound
+	}
+
+	statusMu.RLock()
+	defer statusMu.RUnlock()
+	m, ok := statuses[code]
+	return m, ok
+}
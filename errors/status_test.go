@@ -0,0 +1,49 @@
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantHTTP int
+		wantGRPC GRPCStatusCode
+	}{
+		{"nil", nil, http.StatusOK, GRPCOK},
+		{"invalid input", New(ErrCodeInvalidInput, "bad"), http.StatusBadRequest, GRPCInvalidArgument},
+		{"already exists", New(ErrCodeAlreadyExists, "dup"), http.StatusConflict, GRPCAlreadyExists},
+		{"failed precondition", New(ErrCodeFailedPrecondition, "state"), http.StatusBadRequest, GRPCFailedPrecondition},
+		{"aborted", New(ErrCodeAborted, "retry"), http.StatusConflict, GRPCAborted},
+		{"unavailable", New(ErrCodeUnavailable, "later"), http.StatusServiceUnavailable, GRPCUnavailable},
+		{"wrapped", fmt.Errorf("ctx: %w", New(ErrCodeNotFound, "gone")), http.StatusNotFound, GRPCNotFound},
+		{"bare ErrNotFound", fmt.Errorf("load: %w", ErrNotFound), http.StatusNotFound, GRPCNotFound},
+		{"plain error", stderrors.New("boom"), http.StatusInternalServerError, GRPCInternal},
+		{"unmapped code", New(ErrorCode(9999), "odd"), http.StatusInternalServerError, GRPCInternal},
+	}
+	for _, tt := range tests {
+		if got := HTTPStatus(tt.err); got != tt.wantHTTP {
+			t.Errorf("%s: HTTPStatus = %d, want %d", tt.name, got, tt.wantHTTP)
+		}
+		if got := GRPCCode(tt.err); got != tt.wantGRPC {
+			t.Errorf("%s: GRPCCode = %d, want %d", tt.name, got, tt.wantGRPC)
+		}
+	}
+}
+
+func TestRegisterCode(t *testing.T) {
+	const code ErrorCode = 4291
+	RegisterCode(code, http.StatusTooManyRequests, GRPCResourceExhausted)
+
+	err := New(code, "slow down")
+	if got := HTTPStatus(err); got != http.StatusTooManyRequests {
+		t.Errorf("HTTPStatus = %d, want %d", got, http.StatusTooManyRequests)
+	}
+	if got := GRPCCode(err); got != GRPCResourceExhausted {
+		t.Errorf("GRPCCode = %d, want %d", got, GRPCResourceExhausted)
+	}
+}
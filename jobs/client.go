@@ -0,0 +1,526 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+const (
+	_defaultConcurrency       = 10
+	_defaultPollInterval      = time.Second
+	_defaultHeartbeatInterval = 10 * time.Second
+	_defaultStaleAfter        = time.Minute
+	_defaultMinBackoff        = time.Second
+	_defaultMaxBackoff        = time.Hour
+	_shutdownGrace            = 5 * time.Second
+)
+
+type WorkFunc[T any] func(ctx context.Context, job *Job[T]) error
+
+type Option func(*Client)
+
+// WithQueue makes the client work queue with at most concurrency jobs at a
+// time. Without any WithQueue the client works DefaultQueue.
+func WithQueue(name string, concurrency int) Option {
+	return func(c *Client) {
+		c.queues[name] = concurrency
+	}
+}
+
+func PollInterval(d time.Duration) Option {
+	return func(c *Client) {
+		c.pollInterval = d
+	}
+}
+
+// Heartbeat sets how often running jobs are marked alive, and after how long
+// without a heartbeat a running job is considered abandoned and reclaimed.
+// staleAfter must be longer than interval.
+func Heartbeat(interval, staleAfter time.Duration) Option {
+	return func(c *Client) {
+		c.heartbeatInterval = interval
+		c.staleAfter = staleAfter
+	}
+}
+
+func RetryBackoff(min, max time.Duration) Option {
+	return func(c *Client) {
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+type claimedJob struct {
+	id          int64
+	queue       string
+	kind        string
+	args        []byte
+	attempt     int
+	maxAttempts int
+}
+
+type handler func(ctx context.Context, j claimedJob) error
+
+// Client fetches and runs jobs. Register workers, then Start it; Stop shuts
+// it down gracefully.
+type Client struct {
+	u  tx.Transactor
+	id string
+
+	queues            map[string]int
+	pollInterval      time.Duration
+	heartbeatInterval time.Duration
+	staleAfter        time.Duration
+	minBackoff        time.Duration
+	maxBackoff        time.Duration
+
+	mu          sync.Mutex
+	handlers    map[string]handler
+	inFlight    map[int64]struct{}
+	interrupted []int64
+
+	fetchCtx     context.Context
+	stopFetching context.CancelFunc
+	workCtx      context.Context
+	cancelWork   context.CancelFunc
+	bgCtx        context.Context
+	stopBg       context.CancelFunc
+
+	fetchers sync.WaitGroup
+	workers  sync.WaitGroup
+	bg       sync.WaitGroup
+}
+
+// NewClient returns a client running jobs through u, or an error if the
+// options are invalid, e.g. a non-positive interval or concurrency.
+func NewClient(u tx.Transactor, opts ...Option) (*Client, error) {
+	host, _ := os.Hostname()
+	c := &Client{
+		u:                 u,
+		id:                fmt.Sprintf("%s-%d-%x", host, os.Getpid(), rand.Uint32()),
+		queues:            make(map[string]int),
+		pollInterval:      _defaultPollInterval,
+		heartbeatInterval: _defaultHeartbeatInterval,
+		staleAfter:        _defaultStaleAfter,
+		minBackoff:        _defaultMinBackoff,
+		maxBackoff:        _defaultMaxBackoff,
+		handlers:          make(map[string]handler),
+		inFlight:          make(map[int64]struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if len(c.queues) == 0 {
+		c.queues[DefaultQueue] = _defaultConcurrency
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("jobs: %w", err)
+	}
+
+	return c, nil
+}
+
+func (c *Client) validate() error {
+	for name, concurrency := range c.queues {
+		if concurrency <= 0 {
+			return fmt.Errorf("queue %q: concurrency must be positive, got %d", name, concurrency)
+		}
+	}
+	switch {
+	case c.pollInterval <= 0:
+		return fmt.Errorf("poll interval must be positive, got %s", c.pollInterval)
+	case c.heartbeatInterval <= 0:
+		return fmt.Errorf("heartbeat interval must be positive, got %s", c.heartbeatInterval)
+	case c.staleAfter <= c.heartbeatInterval:
+		return fmt.Errorf("stale after (%s) must be longer than the heartbeat interval (%s)", c.staleAfter, c.heartbeatInterval)
+	case c.minBackoff <= 0 || c.maxBackoff < c.minBackoff:
+		return fmt.Errorf("invalid retry backoff [%s, %s]", c.minBackoff, c.maxBackoff)
+	}
+	return nil
+}
+
+// Register sets the worker for kind. It must be called before Start.
+func Register[T any](c *Client, kind string, fn WorkFunc[T]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.handlers[kind] = func(ctx context.Context, j claimedJob) error {
+		var args T
+		if err := json.Unmarshal(j.args, &args); err != nil {
+			return fmt.Errorf("decode args: %w", err)
+		}
+		return fn(ctx, &Job[T]{
+			ID:          j.id,
+			Queue:       j.queue,
+			Kind:        j.kind,
+			Args:        args,
+			Attempt:     j.attempt,
+			MaxAttempts: j.maxAttempts,
+		})
+	}
+}
+
+// Start begins fetching jobs in the background. Canceling ctx aborts running
+// jobs; use Stop for a graceful shutdown.
+func (c *Client) Start(ctx context.Context) error {
+	if c.fetchCtx != nil {
+		return errors.New("jobs: client already started")
+	}
+
+	c.fetchCtx, c.stopFetching = context.WithCancel(ctx)
+	c.workCtx, c.cancelWork = context.WithCancel(ctx)
+	c.bgCtx, c.stopBg = context.WithCancel(ctx)
+
+	for queue, limit := range c.queues {
+		c.fetchers.Add(1)
+		go c.fetchLoop(queue, limit)
+	}
+
+	c.bg.Add(2)
+	go c.heartbeatLoop()
+	go c.reclaimLoop()
+
+	return nil
+}
+
+// Stop stops fetching and waits for running jobs until ctx is done. Jobs
+// still running then are canceled; those that give up within a short grace
+// period are released back to their queue without using up an attempt. Jobs
+// that ignore the cancellation are left running and reclaimed once their
+// heartbeat expires.
+func (c *Client) Stop(ctx context.Context) error {
+	if c.fetchCtx == nil {
+		return nil
+	}
+
+	c.stopFetching()
+	c.fetchers.Wait()
+
+	var err error
+	if !waitTimeout(&c.workers, ctx.Done()) {
+		err = ctx.Err()
+		c.cancelWork()
+		graceCtx, cancel := context.WithTimeout(context.Background(), _shutdownGrace)
+		waitTimeout(&c.workers, graceCtx.Done())
+		cancel()
+	}
+	c.cancelWork()
+
+	if rerr := c.releaseInFlight(); rerr != nil {
+		err = errors.Join(err, rerr)
+	}
+
+	c.stopBg()
+	c.bg.Wait()
+
+	return err
+}
+
+func waitTimeout(wg *sync.WaitGroup, done <-chan struct{}) bool {
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// ===============================
+// Fetch & work
+// ===============================
+
+func (c *Client) fetchLoop(queue string, limit int) {
+	defer c.fetchers.Done()
+
+	slots := make(chan struct{}, limit)
+	freed := make(chan struct{}, 1)
+	for {
+		if free := limit - len(slots); free > 0 {
+			claimed, err := c.claim(c.fetchCtx, queue, free)
+			if err != nil && c.fetchCtx.Err() == nil {
+				slog.ErrorContext(c.fetchCtx, "jobs: fetch failed", "queue", queue, "error", err)
+			}
+			for _, j := range claimed {
+				slots <- struct{}{}
+				c.workers.Add(1)
+				go c.work(j, func() {
+					<-slots
+					select {
+					case freed <- struct{}{}:
+					default:
+					}
+				})
+			}
+			if len(claimed) == free {
+				continue
+			}
+		}
+
+		select {
+		case <-c.fetchCtx.Done():
+			return
+		case <-freed:
+		case <-time.After(c.pollInterval):
+		}
+	}
+}
+
+func (c *Client) claim(ctx context.Context, queue string, limit int) ([]claimedJob, error) {
+	return tx.WithinTxR(ctx, c.u, func(ctx context.Context) ([]claimedJob, error) {
+		t := tx.TxFrom(ctx)
+		if t == nil {
+			return nil, tx.ErrNoTx
+		}
+
+		rows, err := t.Query(ctx, `
+			UPDATE jobs
+			SET state = 'running', attempts = attempts + 1, locked_by = $3, heartbeat_at = now()
+			WHERE id IN (
+				SELECT id FROM jobs
+				WHERE queue = $1 AND state = 'available' AND run_at <= now()
+				ORDER BY run_at, id
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, queue, kind, args, attempts, max_attempts`,
+			queue, limit, c.id)
+		if err != nil {
+			return nil, err
+		}
+		return pgx.CollectRows(rows, func(row pgx.CollectableRow) (claimedJob, error) {
+			var j claimedJob
+			err := row.Scan(&j.id, &j.queue, &j.kind, &j.args, &j.attempt, &j.maxAttempts)
+			return j, err
+		})
+	})
+}
+
+func (c *Client) work(j claimedJob, release func()) {
+	defer c.workers.Done()
+	defer release()
+
+	c.mu.Lock()
+	c.inFlight[j.id] = struct{}{}
+	h := c.handlers[j.kind]
+	c.mu.Unlock()
+
+	var err error
+	if h == nil {
+		err = fmt.Errorf("no worker registered for kind %q", j.kind)
+	} else {
+		err = runSafely(c.workCtx, h, j)
+	}
+
+	if err != nil && c.workCtx.Err() != nil {
+		// Interrupted by shutdown; Stop releases the job.
+		c.mu.Lock()
+		delete(c.inFlight, j.id)
+		c.interrupted = append(c.interrupted, j.id)
+		c.mu.Unlock()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.workCtx), 10*time.Second)
+	defer cancel()
+	if ferr := c.finish(ctx, j, err); ferr != nil {
+		slog.ErrorContext(ctx, "jobs: record result failed", "id", j.id, "kind", j.kind, "error", ferr)
+	}
+
+	c.mu.Lock()
+	delete(c.inFlight, j.id)
+	c.mu.Unlock()
+}
+
+func runSafely(ctx context.Context, h handler, j claimedJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h(ctx, j)
+}
+
+func (c *Client) finish(ctx context.Context, j claimedJob, jobErr error) error {
+	return tx.WithinTx(ctx, c.u, func(ctx context.Context) error {
+		t := tx.TxFrom(ctx)
+		if t == nil {
+			return tx.ErrNoTx
+		}
+
+		if jobErr == nil {
+			_, err := t.Exec(ctx, `
+				UPDATE jobs
+				SET state = 'completed', finished_at = now(), locked_by = NULL, heartbeat_at = NULL
+				WHERE id = $1 AND locked_by = $2`,
+				j.id, c.id)
+			return err
+		}
+
+		if j.attempt >= j.maxAttempts {
+			slog.ErrorContext(ctx, "jobs: job discarded",
+				"id", j.id, "kind", j.kind, "attempt", j.attempt, "error", jobErr)
+			_, err := t.Exec(ctx, `
+				UPDATE jobs
+				SET state = 'discarded', finished_at = now(), last_error = $3, locked_by = NULL, heartbeat_at = NULL
+				WHERE id = $1 AND locked_by = $2`,
+				j.id, c.id, jobErr.Error())
+			return err
+		}
+
+		delay := c.backoff(j.attempt)
+		slog.WarnContext(ctx, "jobs: job failed",
+			"id", j.id, "kind", j.kind, "attempt", j.attempt, "retry_in", delay, "error", jobErr)
+		_, err := t.Exec(ctx, `
+			UPDATE jobs
+			SET state = 'available', run_at = now() + make_interval(secs => $3), last_error = $4,
+				locked_by = NULL, heartbeat_at = NULL
+			WHERE id = $1 AND locked_by = $2`,
+			j.id, c.id, delay.Seconds(), jobErr.Error())
+		return err
+	})
+}
+
+// backoff grows exponentially with the attempt number, with jitter so that
+// jobs failing together do not retry together.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.minBackoff
+	for i := 1; i < attempt && d < c.maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, c.maxBackoff)
+	return d/2 + rand.N(d/2+1)
+}
+
+// releaseInFlight puts jobs interrupted by Stop back in their queue. Jobs
+// whose handler is still running are not touched: releasing them would let
+// another worker run them concurrently, so they wait for heartbeat expiry.
+func (c *Client) releaseInFlight() error {
+	c.mu.Lock()
+	ids := c.interrupted
+	c.interrupted = nil
+	running := len(c.inFlight)
+	c.mu.Unlock()
+
+	if running > 0 {
+		slog.Warn("jobs: jobs still running after shutdown; they will be reclaimed once their heartbeat expires",
+			"count", running)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return tx.WithinTx(ctx, c.u, func(ctx context.Context) error {
+		t := tx.TxFrom(ctx)
+		if t == nil {
+			return tx.ErrNoTx
+		}
+
+		_, err := t.Exec(ctx, `
+			UPDATE jobs
+			SET state = 'available', attempts = attempts - 1, locked_by = NULL, heartbeat_at = NULL
+			WHERE id = ANY($1) AND locked_by = $2 AND state = 'running'`,
+			ids, c.id)
+		return err
+	})
+}
+
+// ===============================
+// Heartbeats & reclaiming
+// ===============================
+
+func (c *Client) heartbeatLoop() {
+	defer c.bg.Done()
+
+	ticker := time.NewTicker(c.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.bgCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		ids := make([]int64, 0, len(c.inFlight))
+		for id := range c.inFlight {
+			ids = append(ids, id)
+		}
+		c.mu.Unlock()
+		if len(ids) == 0 {
+			continue
+		}
+
+		err := tx.WithinTx(c.bgCtx, c.u, func(ctx context.Context) error {
+			t := tx.TxFrom(ctx)
+			if t == nil {
+				return tx.ErrNoTx
+			}
+
+			_, err := t.Exec(ctx,
+				"UPDATE jobs SET heartbeat_at = now() WHERE id = ANY($1) AND locked_by = $2",
+				ids, c.id)
+			return err
+		})
+		if err != nil && c.bgCtx.Err() == nil {
+			slog.WarnContext(c.bgCtx, "jobs: heartbeat failed", "error", err)
+		}
+	}
+}
+
+// reclaimLoop returns jobs whose worker stopped heartbeating, e.g. because
+// its process crashed, to their queue. The lost run counts as an attempt.
+func (c *Client) reclaimLoop() {
+	defer c.bg.Done()
+
+	ticker := time.NewTicker(c.staleAfter / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.bgCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := tx.WithinTx(c.bgCtx, c.u, func(ctx context.Context) error {
+			t := tx.TxFrom(ctx)
+			if t == nil {
+				return tx.ErrNoTx
+			}
+
+			tag, err := t.Exec(ctx, `
+				UPDATE jobs
+				SET state = CASE WHEN attempts >= max_attempts THEN 'discarded' ELSE 'available' END,
+					finished_at = CASE WHEN attempts >= max_attempts THEN now() END,
+					last_error = 'heartbeat lost',
+					locked_by = NULL,
+					heartbeat_at = NULL
+				WHERE state = 'running' AND heartbeat_at < now() - make_interval(secs => $1)`,
+				c.staleAfter.Seconds())
+			if err == nil && tag.RowsAffected() > 0 {
+				slog.WarnContext(ctx, "jobs: reclaimed abandoned jobs", "count", tag.RowsAffected())
+			}
+			return err
+		})
+		if err != nil && c.bgCtx.Err() == nil {
+			slog.WarnContext(c.bgCtx, "jobs: reclaim failed", "error", err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nghiatrann0502/kyra-kit/postgres/pgtest"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+func TestNewClientRejectsInvalidOptions(t *testing.T) {
+	tests := map[string][]Option{
+		"zero heartbeat":         {Heartbeat(0, 0)},
+		"stale before heartbeat": {Heartbeat(time.Minute, time.Second)},
+		"zero poll interval":     {PollInterval(0)},
+		"zero concurrency":       {WithQueue("q", 0)},
+		"inverted backoff":       {RetryBackoff(time.Minute, time.Second)},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewClient(nil, opts...); err == nil {
+				t.Error("NewClient accepted the options")
+			}
+		})
+	}
+}
+
+func newTestClient(t *testing.T, m *pgtest.Mock) *Client {
+	t.Helper()
+	c, err := NewClient(tx.NewUnitOfWord(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.workCtx, c.cancelWork = context.WithCancel(context.Background())
+	return c
+}
+
+func TestWorkCompletesJobFinishedDuringShutdown(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectExecRegexp(`SET state = 'completed'`).WithArgs(int64(1), pgtest.AnyArg())
+	m.ExpectCommit()
+
+	c := newTestClient(t, m)
+	c.handlers["k"] = func(context.Context, claimedJob) error {
+		c.cancelWork()
+		return nil
+	}
+
+	c.workers.Add(1)
+	c.work(claimedJob{id: 1, kind: "k", attempt: 1, maxAttempts: 3}, func() {})
+
+	if len(c.inFlight) != 0 || len(c.interrupted) != 0 {
+		t.Errorf("inFlight = %v, interrupted = %v; want both empty", c.inFlight, c.interrupted)
+	}
+}
+
+func TestReleaseOnlyInterruptedJobs(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectExecRegexp(`SET state = 'available', attempts = attempts - 1`).
+		WithArgs([]int64{1}, pgtest.AnyArg())
+	m.ExpectCommit()
+
+	c := newTestClient(t, m)
+	c.handlers["k"] = func(ctx context.Context, _ claimedJob) error {
+		c.cancelWork()
+		return ctx.Err()
+	}
+
+	c.workers.Add(1)
+	c.work(claimedJob{id: 1, kind: "k", attempt: 1, maxAttempts: 3}, func() {})
+	// Job 2 ignores the cancellation and is still running.
+	c.inFlight[2] = struct{}{}
+
+	if err := c.releaseInFlight(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.inFlight[2]; !ok {
+		t.Error("still-running job 2 was dropped from inFlight")
+	}
+}
@@ -0,0 +1,150 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+const (
+	DefaultQueue        = "default"
+	_defaultMaxAttempts = 25
+)
+
+// Schema creates the table used by Enqueue and Client.
+const Schema = `
+CREATE TABLE IF NOT EXISTS jobs (
+	id           BIGSERIAL PRIMARY KEY,
+	queue        TEXT NOT NULL DEFAULT 'default',
+	kind         TEXT NOT NULL,
+	args         JSONB NOT NULL DEFAULT '{}',
+	state        TEXT NOT NULL DEFAULT 'available',
+	attempts     INT NOT NULL DEFAULT 0,
+	max_attempts INT NOT NULL DEFAULT 25,
+	run_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+	unique_key   TEXT,
+	locked_by    TEXT,
+	heartbeat_at TIMESTAMPTZ,
+	last_error   TEXT,
+	created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+	finished_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS jobs_fetch_idx
+	ON jobs (queue, run_at, id)
+	WHERE state = 'available';
+
+CREATE INDEX IF NOT EXISTS jobs_running_idx
+	ON jobs (heartbeat_at)
+	WHERE state = 'running';
+
+CREATE UNIQUE INDEX IF NOT EXISTS jobs_unique_key_idx
+	ON jobs (kind, unique_key)
+	WHERE unique_key IS NOT NULL AND state IN ('available', 'running');
+`
+
+// Job states as stored in the state column.
+const (
+	StateAvailable = "available"
+	StateRunning   = "running"
+	StateCompleted = "completed"
+	StateDiscarded = "discarded"
+)
+
+type Job[T any] struct {
+	ID          int64
+	Queue       string
+	Kind        string
+	Args        T
+	Attempt     int
+	MaxAttempts int
+}
+
+// ===============================
+// Enqueue
+// ===============================
+
+type EnqueueOption func(*enqueueParams)
+
+type enqueueParams struct {
+	queue       string
+	runAt       time.Time
+	maxAttempts int
+	uniqueKey   *string
+}
+
+func Queue(name string) EnqueueOption {
+	return func(p *enqueueParams) {
+		p.queue = name
+	}
+}
+
+// RunAt schedules the job to become available at t.
+func RunAt(t time.Time) EnqueueOption {
+	return func(p *enqueueParams) {
+		p.runAt = t
+	}
+}
+
+func MaxAttempts(n int) EnqueueOption {
+	return func(p *enqueueParams) {
+		p.maxAttempts = n
+	}
+}
+
+// UniqueKey allows only one available or running job of the kind with this
+// key. Enqueueing a duplicate returns the ID of the existing job.
+func UniqueKey(key string) EnqueueOption {
+	return func(p *enqueueParams) {
+		p.uniqueKey = &key
+	}
+}
+
+// Enqueue inserts a job in the transaction carried by ctx, so it only becomes
+// visible to workers if the surrounding writes commit. It fails with
+// tx.ErrNoTx outside a transaction.
+func Enqueue[T any](ctx context.Context, kind string, args T, opts ...EnqueueOption) (int64, error) {
+	t := tx.TxFrom(ctx)
+	if t == nil {
+		return 0, tx.ErrNoTx
+	}
+
+	p := enqueueParams{queue: DefaultQueue, maxAttempts: _defaultMaxAttempts}
+	for _, opt := range opts {
+		opt(&p)
+	}
+
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return 0, err
+	}
+
+	var runAt *time.Time
+	if !p.runAt.IsZero() {
+		runAt = &p.runAt
+	}
+
+	var id int64
+	err = t.QueryRow(ctx, `
+		INSERT INTO jobs (queue, kind, args, max_attempts, run_at, unique_key)
+		VALUES ($1, $2, $3, $4, COALESCE($5, now()), $6)
+		ON CONFLICT (kind, unique_key) WHERE unique_key IS NOT NULL AND state IN ('available', 'running')
+		DO NOTHING
+		RETURNING id`,
+		p.queue, kind, raw, p.maxAttempts, runAt, p.uniqueKey).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = t.QueryRow(ctx, `
+			SELECT id FROM jobs
+			WHERE kind = $1 AND unique_key = $2 AND state IN ('available', 'running')`,
+			kind, p.uniqueKey).Scan(&id)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -15,6 +16,20 @@ type Extractor struct {
 	extractor func(context.Context) any
 }
 
+var (
+	extractorsMu sync.RWMutex
+	extractors   []Extractor
+)
+
+// RegisterExtractor adds a field taken from the context to every record
+// logged through a ZapHandler. fn returns nil when ctx has no value.
+func RegisterExtractor(name string, fn func(context.Context) any) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+
+	extractors = append(extractors, Extractor{name: name, extractor: fn})
+}
+
 type ZapHandler struct {
 	logger *zap.Logger
 	attrs  []slog.Attr
@@ -181,19 +196,11 @@ func extractContextValues(ctx context.Context) []zap.Field {
 
 	var fields []zap.Field
 
-	extractors := []Extractor{
-		// {"request_id", func(ctx context.Context) any {
-		// 	return contextutils.RequestIDFromContext(ctx)
-		// }},
-		// {"ip_addr", func(ctx context.Context) any {
-		// 	if val, ok := ctx.Value(utils.CtxIPKey).(string); ok {
-		// 		return val
-		// 	}
-		// 	return nil
-		// }},
-	}
+	extractorsMu.RLock()
+	registered := extractors
+	extractorsMu.RUnlock()
 
-	for _, ext := range extractors {
+	for _, ext := range registered {
 		if val := ext.extractor(ctx); val != nil {
 			switch v := val.(type) {
 			case string:
@@ -0,0 +1,67 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+// Schema creates the table used by Add and the Relay.
+const Schema = `
+CREATE TABLE IF NOT EXISTS outbox (
+	id              BIGSERIAL PRIMARY KEY,
+	topic           TEXT NOT NULL,
+	key             TEXT NOT NULL DEFAULT '',
+	payload         BYTEA NOT NULL,
+	created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+	attempts        INT NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	last_error      TEXT,
+	delivered_at    TIMESTAMPTZ,
+	dead_at         TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx
+	ON outbox (next_attempt_at, id)
+	WHERE delivered_at IS NULL AND dead_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS outbox_undelivered_key_idx
+	ON outbox (key, id)
+	WHERE delivered_at IS NULL;
+`
+
+type Message struct {
+	ID        int64
+	Topic     string
+	Key       string
+	Payload   []byte
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// Add records a message in the transaction carried by ctx, so it is stored
+// if and only if the surrounding business writes commit. It fails with
+// tx.ErrNoTx outside a transaction.
+func Add(ctx context.Context, topic, key string, payload []byte) error {
+	t := tx.TxFrom(ctx)
+	if t == nil {
+		return tx.ErrNoTx
+	}
+
+	_, err := t.Exec(ctx,
+		"INSERT INTO outbox (topic, key, payload) VALUES ($1, $2, $3)",
+		topic, key, payload)
+	return err
+}
+
+// PurgeDelivered deletes messages delivered more than olderThan ago.
+func PurgeDelivered(ctx context.Context, db tx.DBTX, olderThan time.Duration) (int64, error) {
+	tag, err := db.Exec(ctx,
+		"DELETE FROM outbox WHERE delivered_at < now() - make_interval(secs => $1)",
+		olderThan.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
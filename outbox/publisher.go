@@ -0,0 +1,64 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Publisher delivers a message to the outside world. It must be safe to call
+// again for the same message: delivery is at-least-once.
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+type PublisherFunc func(ctx context.Context, msg Message) error
+
+func (f PublisherFunc) Publish(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// MemoryPublisher keeps published messages in memory, for tests.
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, msg Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, msg)
+	return nil
+}
+
+func (p *MemoryPublisher) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Message(nil), p.messages...)
+}
+
+// LogPublisher writes every message to a logger.
+type LogPublisher struct {
+	logger *slog.Logger
+}
+
+func NewLogPublisher(logger *slog.Logger) *LogPublisher {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &LogPublisher{logger: logger}
+}
+
+func (p *LogPublisher) Publish(ctx context.Context, msg Message) error {
+	p.logger.InfoContext(ctx, "outbox message",
+		"id", msg.ID,
+		"topic", msg.Topic,
+		"key", msg.Key,
+		"payload", string(msg.Payload),
+	)
+	return nil
+}
@@ -0,0 +1,201 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+const (
+	_defaultBatchSize    = 100
+	_defaultPollInterval = time.Second
+	_defaultMaxAttempts  = 10
+	_defaultMinBackoff   = time.Second
+	_defaultMaxBackoff   = 10 * time.Minute
+)
+
+type RelayOption func(*Relay)
+
+func BatchSize(n int) RelayOption {
+	return func(r *Relay) {
+		r.batchSize = n
+	}
+}
+
+func PollInterval(d time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.pollInterval = d
+	}
+}
+
+// MaxAttempts sets how many failed deliveries move a message to the dead
+// letter state (dead_at set). Dead messages are never retried automatically.
+func MaxAttempts(n int) RelayOption {
+	return func(r *Relay) {
+		r.maxAttempts = n
+	}
+}
+
+func Backoff(min, max time.Duration) RelayOption {
+	return func(r *Relay) {
+		r.minBackoff = min
+		r.maxBackoff = max
+	}
+}
+
+// Relay moves messages from the outbox table to a Publisher. Several relays
+// may run side by side: rows are claimed with FOR UPDATE SKIP LOCKED.
+//
+// Messages sharing a non-empty key are published in id order: a message is
+// only claimed once every earlier message with its key has been delivered.
+// A failing message therefore holds back the rest of its key until it is
+// retried successfully, and a dead-lettered one until it is delivered or
+// deleted by hand. Messages without a key are not ordered.
+type Relay struct {
+	u   tx.Transactor
+	pub Publisher
+
+	batchSize    int
+	pollInterval time.Duration
+	maxAttempts  int
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+}
+
+func NewRelay(u tx.Transactor, pub Publisher, opts ...RelayOption) (*Relay, error) {
+	r := &Relay{
+		u:            u,
+		pub:          pub,
+		batchSize:    _defaultBatchSize,
+		pollInterval: _defaultPollInterval,
+		maxAttempts:  _defaultMaxAttempts,
+		minBackoff:   _defaultMinBackoff,
+		maxBackoff:   _defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	switch {
+	case r.batchSize <= 0:
+		return nil, fmt.Errorf("outbox: batch size must be positive, got %d", r.batchSize)
+	case r.pollInterval <= 0:
+		return nil, fmt.Errorf("outbox: poll interval must be positive, got %s", r.pollInterval)
+	case r.maxAttempts <= 0:
+		return nil, fmt.Errorf("outbox: max attempts must be positive, got %d", r.maxAttempts)
+	case r.minBackoff <= 0 || r.maxBackoff < r.minBackoff:
+		return nil, fmt.Errorf("outbox: invalid backoff [%s, %s]", r.minBackoff, r.maxBackoff)
+	}
+
+	return r, nil
+}
+
+// Run relays until ctx is done. Full batches are followed immediately by the
+// next one; otherwise the relay waits for the poll interval.
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		n, err := r.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "outbox relay failed", "error", err)
+		}
+		if err == nil && n == r.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.pollInterval):
+		}
+	}
+}
+
+// RelayOnce claims one batch of due messages and tries to publish each of
+// them. It returns the number of messages claimed.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	return tx.WithinTxR(ctx, r.u, func(ctx context.Context) (int, error) {
+		t := tx.TxFrom(ctx)
+		if t == nil {
+			return 0, tx.ErrNoTx
+		}
+
+		rows, err := t.Query(ctx, `
+			SELECT id, topic, key, payload, attempts, created_at
+			FROM outbox o
+			WHERE delivered_at IS NULL AND dead_at IS NULL AND next_attempt_at <= now()
+				AND (key = '' OR NOT EXISTS (
+					SELECT 1 FROM outbox e
+					WHERE e.key = o.key AND e.id < o.id AND e.delivered_at IS NULL
+				))
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED`, r.batchSize)
+		if err != nil {
+			return 0, err
+		}
+		msgs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Message, error) {
+			var m Message
+			err := row.Scan(&m.ID, &m.Topic, &m.Key, &m.Payload, &m.Attempts, &m.CreatedAt)
+			return m, err
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		// The claim holds at most one message per key, so each can be
+		// published independently.
+		var delivered []int64
+		for _, m := range msgs {
+			if err := r.pub.Publish(ctx, m); err != nil {
+				if err := r.fail(ctx, t, m, err); err != nil {
+					return 0, err
+				}
+				continue
+			}
+			delivered = append(delivered, m.ID)
+		}
+
+		if len(delivered) > 0 {
+			if _, err := t.Exec(ctx,
+				"UPDATE outbox SET delivered_at = now() WHERE id = ANY($1)", delivered); err != nil {
+				return 0, err
+			}
+		}
+
+		return len(msgs), nil
+	})
+}
+
+func (r *Relay) fail(ctx context.Context, t pgx.Tx, m Message, cause error) error {
+	attempts := m.Attempts + 1
+	if attempts >= r.maxAttempts {
+		slog.ErrorContext(ctx, "outbox message dead-lettered",
+			"id", m.ID, "topic", m.Topic, "attempts", attempts, "error", cause)
+		_, err := t.Exec(ctx,
+			"UPDATE outbox SET attempts = $2, last_error = $3, dead_at = now() WHERE id = $1",
+			m.ID, attempts, cause.Error())
+		return err
+	}
+
+	delay := r.backoff(attempts)
+	slog.WarnContext(ctx, "outbox publish failed",
+		"id", m.ID, "topic", m.Topic, "attempts", attempts, "retry_in", delay, "error", cause)
+	_, err := t.Exec(ctx, `
+		UPDATE outbox
+		SET attempts = $2, last_error = $3, next_attempt_at = now() + make_interval(secs => $4)
+		WHERE id = $1`,
+		m.ID, attempts, cause.Error(), delay.Seconds())
+	return err
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.minBackoff
+	for i := 1; i < attempts && d < r.maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, r.maxBackoff)
+}
@@ -0,0 +1,157 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nghiatrann0502/kyra-kit/postgres/pgtest"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+const claimSQL = `(?s)FROM outbox o.*NOT EXISTS.*e\.key = o\.key AND e\.id < o\.id AND e\.delivered_at IS NULL.*FOR UPDATE SKIP LOCKED`
+
+func newTestRelay(t *testing.T, m *pgtest.Mock, pub Publisher, opts ...RelayOption) *Relay {
+	t.Helper()
+	r, err := NewRelay(tx.NewUnitOfWord(m), pub, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func messageRows(msgs ...Message) *pgtest.Rows {
+	rows := pgtest.NewRows("id", "topic", "key", "payload", "attempts", "created_at")
+	for _, m := range msgs {
+		rows.AddRow(m.ID, m.Topic, m.Key, m.Payload, m.Attempts, m.CreatedAt)
+	}
+	return rows
+}
+
+func TestNewRelayRejectsInvalidOptions(t *testing.T) {
+	tests := map[string]RelayOption{
+		"zero batch size":    BatchSize(0),
+		"zero poll interval": PollInterval(0),
+		"zero max attempts":  MaxAttempts(0),
+		"zero min backoff":   Backoff(0, time.Second),
+		"inverted backoff":   Backoff(time.Minute, time.Second),
+	}
+	for name, opt := range tests {
+		if _, err := NewRelay(nil, NewMemoryPublisher(), opt); err == nil {
+			t.Errorf("%s: NewRelay succeeded, want error", name)
+		}
+	}
+}
+
+func TestRelayOncePublishesAndMarksDelivered(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectQueryRegexp(claimSQL).WithArgs(10).WillReturnRows(messageRows(
+		Message{ID: 1, Topic: "orders", Key: "a", Payload: []byte("1")},
+		Message{ID: 2, Topic: "orders", Key: "b", Payload: []byte("2")},
+	))
+	m.ExpectExec("UPDATE outbox SET delivered_at = now() WHERE id = ANY($1)").WithArgs([]int64{1, 2})
+	m.ExpectCommit()
+
+	pub := NewMemoryPublisher()
+	n, err := newTestRelay(t, m, pub, BatchSize(10)).RelayOnce(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("claimed %d, want 2", n)
+	}
+	if got := pub.Messages(); len(got) != 2 || got[0].ID != 1 || got[1].ID != 2 {
+		t.Errorf("published %+v, want messages 1 and 2 in order", got)
+	}
+}
+
+func TestRelayOnceSchedulesRetry(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectQueryRegexp(claimSQL).WillReturnRows(messageRows(
+		Message{ID: 1, Topic: "orders", Key: "a", Attempts: 2},
+		Message{ID: 2, Topic: "orders", Key: "b"},
+	))
+	// Third failed attempt: min backoff doubled twice.
+	m.ExpectExecRegexp(`SET attempts = \$2, last_error = \$3, next_attempt_at`).
+		WithArgs(int64(1), 3, "broker down", 4.0)
+	m.ExpectExec("UPDATE outbox SET delivered_at = now() WHERE id = ANY($1)").WithArgs([]int64{2})
+	m.ExpectCommit()
+
+	pub := PublisherFunc(func(_ context.Context, msg Message) error {
+		if msg.Key == "a" {
+			return errors.New("broker down")
+		}
+		return nil
+	})
+	r := newTestRelay(t, m, pub, Backoff(time.Second, time.Minute))
+	if _, err := r.RelayOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRelayOnceDeadLetters(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectQueryRegexp(claimSQL).WillReturnRows(messageRows(
+		Message{ID: 7, Topic: "orders", Key: "a", Attempts: 2},
+	))
+	m.ExpectExecRegexp(`dead_at = now\(\)`).WithArgs(int64(7), 3, "rejected")
+	m.ExpectCommit()
+
+	pub := PublisherFunc(func(context.Context, Message) error { return errors.New("rejected") })
+	r := newTestRelay(t, m, pub, MaxAttempts(3))
+	if _, err := r.RelayOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRelayOnceKeepsKeyOrderAfterFailure(t *testing.T) {
+	// Message 1 fails. The next claim only returns message 3: message 2
+	// shares key "a" and stays behind the undelivered message 1, which the
+	// claim query enforces with NOT EXISTS.
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectQueryRegexp(claimSQL).WillReturnRows(messageRows(Message{ID: 1, Key: "a"}))
+	m.ExpectExecRegexp(`next_attempt_at`).WithArgs(int64(1), 1, "broker down", pgtest.AnyArg())
+	m.ExpectCommit()
+	m.ExpectBegin()
+	m.ExpectQueryRegexp(claimSQL).WillReturnRows(messageRows(Message{ID: 3, Key: "b"}))
+	m.ExpectExec("UPDATE outbox SET delivered_at = now() WHERE id = ANY($1)").WithArgs([]int64{3})
+	m.ExpectCommit()
+
+	var published []int64
+	pub := PublisherFunc(func(_ context.Context, msg Message) error {
+		published = append(published, msg.ID)
+		if msg.ID == 1 {
+			return errors.New("broker down")
+		}
+		return nil
+	})
+	r := newTestRelay(t, m, pub)
+	for range 2 {
+		if _, err := r.RelayOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(published) != 2 || published[0] != 1 || published[1] != 3 {
+		t.Errorf("published %v, want [1 3]", published)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	r := &Relay{minBackoff: time.Second, maxBackoff: 10 * time.Second}
+	for attempts, want := range map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		4:  8 * time.Second,
+		5:  10 * time.Second,
+		50: 10 * time.Second,
+	} {
+		if got := r.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
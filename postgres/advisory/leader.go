@@ -0,0 +1,176 @@
+package advisory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/nghiatrann0502/kyra-kit/postgres"
+)
+
+const (
+	_defaultElectionInterval    = 5 * time.Second
+	_defaultHealthCheckInterval = 2 * time.Second
+)
+
+type ElectorOption func(*LeaderElector)
+
+// OnElected is called when this replica becomes leader. ctx is canceled as
+// soon as leadership is lost, so work started from the callback should watch
+// it. The callback runs on the elector goroutine and should return quickly.
+func OnElected(fn func(ctx context.Context)) ElectorOption {
+	return func(e *LeaderElector) {
+		e.onElected = fn
+	}
+}
+
+// OnRevoked is called after leadership is lost or given up.
+func OnRevoked(fn func()) ElectorOption {
+	return func(e *LeaderElector) {
+		e.onRevoked = fn
+	}
+}
+
+func ElectionInterval(d time.Duration) ElectorOption {
+	return func(e *LeaderElector) {
+		e.electionInterval = d
+	}
+}
+
+func HealthCheckInterval(d time.Duration) ElectorOption {
+	return func(e *LeaderElector) {
+		e.healthCheckInterval = d
+	}
+}
+
+// LeaderElector keeps a session-level advisory lock on a connection it holds
+// out of the pool while running. Whoever holds the lock is leader; if the
+// connection drops, Postgres releases the lock and another replica takes
+// over.
+type LeaderElector struct {
+	db  postgres.DBEngine
+	key int64
+
+	onElected           func(ctx context.Context)
+	onRevoked           func()
+	electionInterval    time.Duration
+	healthCheckInterval time.Duration
+
+	leader atomic.Bool
+}
+
+func NewLeaderElector(db postgres.DBEngine, key int64, opts ...ElectorOption) (*LeaderElector, error) {
+	e := &LeaderElector{
+		db:                  db,
+		key:                 key,
+		electionInterval:    _defaultElectionInterval,
+		healthCheckInterval: _defaultHealthCheckInterval,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	if e.electionInterval <= 0 {
+		return nil, fmt.Errorf("advisory: election interval must be positive, got %s", e.electionInterval)
+	}
+	if e.healthCheckInterval <= 0 {
+		return nil, fmt.Errorf("advisory: health check interval must be positive, got %s", e.healthCheckInterval)
+	}
+
+	return e, nil
+}
+
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run campaigns for leadership until ctx is done, then releases the lock.
+func (e *LeaderElector) Run(ctx context.Context) error {
+	for {
+		if err := e.campaign(ctx); err != nil && ctx.Err() == nil {
+			slog.WarnContext(ctx, "leader election failed", "key", e.key, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(e.electionInterval):
+		}
+	}
+}
+
+// campaign holds one connection until it fails or ctx is done.
+func (e *LeaderElector) campaign(ctx context.Context) error {
+	conn, err := e.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	for {
+		var acquired bool
+		if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", e.key).Scan(&acquired); err != nil {
+			conn.Release()
+			return err
+		}
+		if acquired {
+			err := e.lead(ctx, conn)
+			e.resign(ctx, conn)
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			conn.Release()
+			return ctx.Err()
+		case <-time.After(e.electionInterval):
+		}
+	}
+}
+
+// resign gives up the lock. If the connection cannot unlock, it is closed,
+// which releases the lock too.
+func (e *LeaderElector) resign(ctx context.Context, conn postgres.Conn) {
+	unlockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+	defer cancel()
+
+	if _, err := conn.Exec(unlockCtx, "SELECT pg_advisory_unlock($1)", e.key); err != nil {
+		_ = conn.Destroy(unlockCtx)
+		return
+	}
+	conn.Release()
+}
+
+func (e *LeaderElector) lead(ctx context.Context, conn postgres.Conn) error {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		e.leader.Store(false)
+		if e.onRevoked != nil {
+			e.onRevoked()
+		}
+	}()
+
+	e.leader.Store(true)
+	slog.InfoContext(ctx, "elected leader", "key", e.key)
+	if e.onElected != nil {
+		e.onElected(leaderCtx)
+	}
+
+	ticker := time.NewTicker(e.healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			pingCtx, cancelPing := context.WithTimeout(ctx, e.healthCheckInterval)
+			_, err := conn.Exec(pingCtx, "SELECT 1")
+			cancelPing()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
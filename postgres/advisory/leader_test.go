@@ -0,0 +1,79 @@
+package advisory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nghiatrann0502/kyra-kit/postgres/pgtest"
+)
+
+func TestNewLeaderElectorRejectsInvalidIntervals(t *testing.T) {
+	for name, opt := range map[string]ElectorOption{
+		"zero election interval":     ElectionInterval(0),
+		"negative health check":      HealthCheckInterval(-time.Second),
+		"zero health check interval": HealthCheckInterval(0),
+	} {
+		if _, err := NewLeaderElector(nil, 1, opt); err == nil {
+			t.Errorf("%s: NewLeaderElector succeeded, want error", name)
+		}
+	}
+}
+
+func TestCampaignElectsAndRevokes(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectAcquire()
+	m.ExpectQuery("SELECT pg_try_advisory_lock($1)").WithArgs(int64(9)).WillReturnRows(lockResult(true))
+	m.ExpectExec("SELECT 1")
+	m.ExpectExec("SELECT 1").WillReturnError(errors.New("conn lost"))
+	m.ExpectExec("SELECT pg_advisory_unlock($1)").WithArgs(int64(9))
+	m.ExpectRelease()
+
+	var events []string
+	var leaderCtx context.Context
+	e, err := NewLeaderElector(m, 9,
+		HealthCheckInterval(time.Millisecond),
+		OnElected(func(ctx context.Context) {
+			leaderCtx = ctx
+			events = append(events, "elected")
+		}),
+		OnRevoked(func() { events = append(events, "revoked") }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.campaign(context.Background()); err == nil || err.Error() != "conn lost" {
+		t.Errorf("campaign = %v, want the health check error", err)
+	}
+	if len(events) != 2 || events[0] != "elected" || events[1] != "revoked" {
+		t.Errorf("events = %v, want [elected revoked]", events)
+	}
+	if leaderCtx.Err() == nil {
+		t.Error("leadership context not canceled after revocation")
+	}
+	if e.IsLeader() {
+		t.Error("still leader after revocation")
+	}
+}
+
+func TestCampaignReleasesConnWhenNotElected(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectAcquire()
+	m.ExpectQuery("SELECT pg_try_advisory_lock($1)").WillReturnRows(lockResult(false))
+	m.ExpectRelease()
+
+	e, err := NewLeaderElector(m, 9, OnElected(func(context.Context) {
+		t.Error("elected without the lock")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := e.campaign(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("campaign = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,97 @@
+package advisory
+
+import (
+	"context"
+	"hash/fnv"
+
+	"github.com/nghiatrann0502/kyra-kit/postgres"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+// Key hashes name into an advisory lock key. The hash is computed client-side
+// (FNV-1a) so every service derives the same key for the same name.
+func Key(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// ===============================
+// Session locks
+// ===============================
+
+// WithLock runs fn while holding the session-level lock key, waiting for it if
+// another session holds it. The lock lives on a connection taken from the
+// pool for the duration of fn.
+func WithLock(ctx context.Context, db postgres.DBEngine, key int64, fn func(ctx context.Context) error) error {
+	_, err := withSessionLock(ctx, db, "SELECT true FROM pg_advisory_lock($1)", key, fn)
+	return err
+}
+
+// TryLock is like WithLock but does not wait. It reports false without calling
+// fn when the lock is already held.
+func TryLock(ctx context.Context, db postgres.DBEngine, key int64, fn func(ctx context.Context) error) (bool, error) {
+	return withSessionLock(ctx, db, "SELECT pg_try_advisory_lock($1)", key, fn)
+}
+
+func withSessionLock(ctx context.Context, db postgres.DBEngine, lockSQL string, key int64, fn func(ctx context.Context) error) (bool, error) {
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var acquired bool
+	if err := conn.QueryRow(ctx, lockSQL, key).Scan(&acquired); err != nil {
+		conn.Release()
+		return false, err
+	}
+	if !acquired {
+		conn.Release()
+		return false, nil
+	}
+
+	defer func() {
+		// Unlock even if ctx is already done. If that fails the connection
+		// is closed instead of going back to the pool still holding the lock.
+		if _, err := conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", key); err != nil {
+			_ = conn.Destroy(context.WithoutCancel(ctx))
+			return
+		}
+		conn.Release()
+	}()
+
+	return true, fn(ctx)
+}
+
+// ===============================
+// Transaction locks
+// ===============================
+
+// WithXactLock runs fn inside tx.WithinTx while holding the transaction-level
+// lock key. The lock is released when the (outermost) transaction ends.
+func WithXactLock(ctx context.Context, u tx.Transactor, key int64, fn func(ctx context.Context) error) error {
+	return tx.WithinTx(ctx, u, func(ctx context.Context) error {
+		t := tx.TxFrom(ctx)
+		if t == nil {
+			return tx.ErrNoTx
+		}
+
+		if _, err := t.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", key); err != nil {
+			return err
+		}
+		return fn(ctx)
+	})
+}
+
+// TryXactLock tries to take the transaction-level lock key on the transaction
+// in ctx without waiting.
+func TryXactLock(ctx context.Context, key int64) (bool, error) {
+	t := tx.TxFrom(ctx)
+	if t == nil {
+		return false, tx.ErrNoTx
+	}
+
+	var acquired bool
+	err := t.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock($1)", key).Scan(&acquired)
+	return acquired, err
+}
@@ -0,0 +1,70 @@
+package advisory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nghiatrann0502/kyra-kit/postgres/pgtest"
+)
+
+func lockResult(ok bool) *pgtest.Rows {
+	return pgtest.NewRows("locked").AddRow(ok)
+}
+
+func TestTryLock(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectAcquire()
+	m.ExpectQuery("SELECT pg_try_advisory_lock($1)").WithArgs(int64(42)).WillReturnRows(lockResult(true))
+	m.ExpectExec("SELECT pg_advisory_unlock($1)").WithArgs(int64(42))
+	m.ExpectRelease()
+
+	ran := false
+	ok, err := TryLock(context.Background(), m, 42, func(context.Context) error {
+		ran = true
+		return nil
+	})
+	if err != nil || !ok || !ran {
+		t.Errorf("TryLock = %t, %v; ran = %t", ok, err, ran)
+	}
+}
+
+func TestTryLockHeldElsewhere(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectAcquire()
+	m.ExpectQuery("SELECT pg_try_advisory_lock($1)").WithArgs(int64(42)).WillReturnRows(lockResult(false))
+	m.ExpectRelease()
+
+	ok, err := TryLock(context.Background(), m, 42, func(context.Context) error {
+		t.Error("fn ran without the lock")
+		return nil
+	})
+	if err != nil || ok {
+		t.Errorf("TryLock = %t, %v; want false, nil", ok, err)
+	}
+}
+
+func TestWithLockReturnsFnError(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectAcquire()
+	m.ExpectQuery("SELECT true FROM pg_advisory_lock($1)").WithArgs(int64(7)).WillReturnRows(lockResult(true))
+	m.ExpectExec("SELECT pg_advisory_unlock($1)").WithArgs(int64(7))
+	m.ExpectRelease()
+
+	boom := errors.New("boom")
+	if err := WithLock(context.Background(), m, 7, func(context.Context) error { return boom }); !errors.Is(err, boom) {
+		t.Errorf("WithLock = %v, want %v", err, boom)
+	}
+}
+
+func TestWithLockDestroysConnWhenUnlockFails(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectAcquire()
+	m.ExpectQuery("SELECT true FROM pg_advisory_lock($1)").WithArgs(int64(7)).WillReturnRows(lockResult(true))
+	m.ExpectExec("SELECT pg_advisory_unlock($1)").WillReturnError(errors.New("conn lost"))
+	m.ExpectDestroy()
+
+	if err := WithLock(context.Background(), m, 7, func(context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DedicatedConn opens a connection outside the pool, using the pool's
+// configuration and connect hooks. The caller owns the connection and must
+// close it.
+func DedicatedConn(ctx context.Context, db DBEngine) (*pgx.Conn, error) {
+	cfg := db.GetDB().Config()
+
+	connCfg := cfg.ConnConfig
+	if cfg.BeforeConnect != nil {
+		if err := cfg.BeforeConnect(ctx, connCfg); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := pgx.ConnectConfig(ctx, connCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.AfterConnect != nil {
+		if err := cfg.AfterConnect(ctx, conn); err != nil {
+			_ = conn.Close(ctx)
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
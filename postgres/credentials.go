@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const _defaultCredentialsPollInterval = 10 * time.Second
+
+// ===============================
+// Credential rotation
+// ===============================
+
+type Credentials struct {
+	User     string
+	Password string
+}
+
+// CredentialsProvider is consulted before every new connection, so rotated
+// passwords or short-lived tokens are picked up without a restart. Empty
+// fields keep the value from the connection string.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+type CredentialsFunc func(ctx context.Context) (Credentials, error)
+
+func (f CredentialsFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// CredentialsWatcher is implemented by providers that know when credentials
+// change. The engine then recycles its connections: idle ones are closed
+// right away, busy ones when they are released.
+type CredentialsWatcher interface {
+	Watch(ctx context.Context, onChange func())
+}
+
+func installCredentials(cfg *pgxpool.Config, provider CredentialsProvider) {
+	if provider == nil {
+		return
+	}
+
+	prev := cfg.BeforeConnect
+	cfg.BeforeConnect = func(ctx context.Context, connCfg *pgx.ConnConfig) error {
+		if prev != nil {
+			if err := prev(ctx, connCfg); err != nil {
+				return err
+			}
+		}
+
+		creds, err := provider.Credentials(ctx)
+		if err != nil {
+			return fmt.Errorf("get credentials: %w", err)
+		}
+		if creds.User != "" {
+			connCfg.User = creds.User
+		}
+		if creds.Password != "" {
+			connCfg.Password = creds.Password
+		}
+		return nil
+	}
+}
+
+// ===============================
+// File provider
+// ===============================
+
+// FileCredentials reads credentials from a file such as a mounted secret. The
+// file holds either a JSON object {"user": "...", "password": "..."} or just
+// the password. It is polled for changes, which also works for secrets
+// swapped in through symlinks.
+type FileCredentials struct {
+	path     string
+	interval time.Duration
+}
+
+var (
+	_ CredentialsProvider = (*FileCredentials)(nil)
+	_ CredentialsWatcher  = (*FileCredentials)(nil)
+)
+
+func NewFileCredentials(path string, pollInterval time.Duration) *FileCredentials {
+	if pollInterval <= 0 {
+		pollInterval = _defaultCredentialsPollInterval
+	}
+	return &FileCredentials{path: path, interval: pollInterval}
+}
+
+func (f *FileCredentials) Credentials(context.Context) (Credentials, error) {
+	raw, err := os.ReadFile(f.path)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '{' {
+		var c struct {
+			User     string `json:"user"`
+			Password string `json:"password"`
+		}
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return Credentials{}, fmt.Errorf("parse %s: %w", f.path, err)
+		}
+		return Credentials{User: c.User, Password: c.Password}, nil
+	}
+
+	return Credentials{Password: string(raw)}, nil
+}
+
+// Watch calls onChange whenever the file's contents change, until ctx is
+// done.
+func (f *FileCredentials) Watch(ctx context.Context, onChange func()) {
+	last, _ := os.ReadFile(f.path)
+
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current, err := os.ReadFile(f.path)
+		if err != nil {
+			slog.WarnContext(ctx, "read credentials file failed", "path", f.path, "error", err)
+			continue
+		}
+		if !bytes.Equal(current, last) {
+			last = current
+			slog.InfoContext(ctx, "credentials changed, recycling connections", "path", f.path)
+			onChange()
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ===============================
+// Pool queries
+// ===============================
+
+// acquire returns a pooled connection with the settings in ctx applied.
+func (p *postgres) acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	// Applied below, where the error can be returned.
+	conn, err := p.db.Acquire(WithoutSettings(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if err := p.settings.apply(ctx, conn.Conn()); err != nil {
+		conn.Release()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (p *postgres) Acquire(ctx context.Context) (Conn, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &poolConn{Conn: conn}, nil
+}
+
+type poolConn struct {
+	*pgxpool.Conn
+}
+
+func (c *poolConn) Destroy(ctx context.Context) error {
+	return c.Hijack().Close(ctx)
+}
+
+func (p *postgres) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	defer conn.Release()
+
+	return conn.Exec(ctx, sql, args...)
+}
+
+// Query holds its connection until the rows are closed or read to the end.
+func (p *postgres) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	conn, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+
+	return &connRows{Rows: rows, conn: conn}, nil
+}
+
+func (p *postgres) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	rows, err := p.Query(ctx, sql, args...)
+	return &connRow{rows: rows, err: err}
+}
+
+// connRows releases its connection once the rows are done.
+type connRows struct {
+	pgx.Rows
+	conn *pgxpool.Conn
+	once sync.Once
+}
+
+func (r *connRows) release() {
+	r.once.Do(r.conn.Release)
+}
+
+func (r *connRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.release()
+	return false
+}
+
+func (r *connRows) Close() {
+	r.Rows.Close()
+	r.release()
+}
+
+type connRow struct {
+	rows pgx.Rows
+	err  error
+}
+
+func (r *connRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return err
+	}
+	r.rows.Close()
+	return r.rows.Err()
+}
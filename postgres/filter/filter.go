@@ -0,0 +1,186 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ===============================
+// Predicates
+// ===============================
+
+// Predicate is a fragment of a WHERE clause. Column names are written into
+// the SQL verbatim and must come from code, never from user input; values are
+// always bound as $n parameters.
+type Predicate interface {
+	build(b *builder) string
+}
+
+type predicateFunc func(b *builder) string
+
+func (f predicateFunc) build(b *builder) string { return f(b) }
+
+type builder struct {
+	args   []any
+	offset int
+}
+
+func (b *builder) bind(v any) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", b.offset+len(b.args))
+}
+
+func compare(col, op string, v any) Predicate {
+	return predicateFunc(func(b *builder) string {
+		return col + " " + op + " " + b.bind(v)
+	})
+}
+
+func Eq(col string, v any) Predicate  { return compare(col, "=", v) }
+func Ne(col string, v any) Predicate  { return compare(col, "<>", v) }
+func Lt(col string, v any) Predicate  { return compare(col, "<", v) }
+func Lte(col string, v any) Predicate { return compare(col, "<=", v) }
+func Gt(col string, v any) Predicate  { return compare(col, ">", v) }
+func Gte(col string, v any) Predicate { return compare(col, ">=", v) }
+
+func Like(col, pattern string) Predicate  { return compare(col, "LIKE", pattern) }
+func ILike(col, pattern string) Predicate { return compare(col, "ILIKE", pattern) }
+
+// Contains matches col case-insensitively against s as a literal substring.
+func Contains(col, s string) Predicate {
+	return ILike(col, "%"+EscapeLike(s)+"%")
+}
+
+// EscapeLike escapes LIKE wildcards so s matches literally.
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func IsNull(col string) Predicate {
+	return predicateFunc(func(*builder) string { return col + " IS NULL" })
+}
+
+func IsNotNull(col string) Predicate {
+	return predicateFunc(func(*builder) string { return col + " IS NOT NULL" })
+}
+
+// In matches col against any element of vs, bound as a single array parameter.
+func In[T any](col string, vs []T) Predicate {
+	return predicateFunc(func(b *builder) string {
+		return col + " = ANY(" + b.bind(vs) + ")"
+	})
+}
+
+// Range matches from <= col < to. A nil bound is left open; with both bounds
+// nil the predicate disappears.
+func Range[T any](col string, from, to *T) Predicate {
+	var ps []Predicate
+	if from != nil {
+		ps = append(ps, Gte(col, *from))
+	}
+	if to != nil {
+		ps = append(ps, Lt(col, *to))
+	}
+	return And(ps...)
+}
+
+// ===============================
+// Optional predicates
+// ===============================
+
+// OptEq is Eq when v is non-nil and disappears otherwise.
+func OptEq[T any](col string, v *T) Predicate {
+	if v == nil {
+		return empty{}
+	}
+	return Eq(col, *v)
+}
+
+// OptIn is In when vs is non-nil and disappears otherwise. An empty, non-nil
+// slice still matches nothing.
+func OptIn[T any](col string, vs []T) Predicate {
+	if vs == nil {
+		return empty{}
+	}
+	return In(col, vs)
+}
+
+// OptContains is Contains when s is non-nil and non-empty.
+func OptContains(col string, s *string) Predicate {
+	if s == nil || *s == "" {
+		return empty{}
+	}
+	return Contains(col, *s)
+}
+
+// When returns p if cond holds and an empty predicate otherwise.
+func When(cond bool, p Predicate) Predicate {
+	if !cond {
+		return empty{}
+	}
+	return p
+}
+
+type empty struct{}
+
+func (empty) build(*builder) string { return "" }
+
+// ===============================
+// Combinators
+// ===============================
+
+func And(ps ...Predicate) Predicate { return join(" AND ", ps) }
+func Or(ps ...Predicate) Predicate  { return join(" OR ", ps) }
+
+func Not(p Predicate) Predicate {
+	return predicateFunc(func(b *builder) string {
+		sql := p.build(b)
+		if sql == "" {
+			return ""
+		}
+		return "NOT (" + sql + ")"
+	})
+}
+
+func join(sep string, ps []Predicate) Predicate {
+	return predicateFunc(func(b *builder) string {
+		parts := make([]string, 0, len(ps))
+		for _, p := range ps {
+			if p == nil {
+				continue
+			}
+			if sql := p.build(b); sql != "" {
+				parts = append(parts, sql)
+			}
+		}
+
+		switch len(parts) {
+		case 0:
+			return ""
+		case 1:
+			return parts[0]
+		default:
+			return "(" + strings.Join(parts, sep) + ")"
+		}
+	})
+}
+
+// ===============================
+// Build
+// ===============================
+
+// Build renders p with placeholders starting at argOffset+1. An empty
+// predicate renders as "TRUE" so the result can always follow WHERE.
+func Build(p Predicate, argOffset int) (string, []any) {
+	b := &builder{offset: argOffset}
+	sql := ""
+	if p != nil {
+		sql = p.build(b)
+	}
+	if sql == "" {
+		return "TRUE", b.args
+	}
+	return sql, b.args
+}
@@ -0,0 +1,68 @@
+package filter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuild(t *testing.T) {
+	name := "bob"
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var none *string
+
+	tests := []struct {
+		name     string
+		p        Predicate
+		offset   int
+		wantSQL  string
+		wantArgs []any
+	}{
+		{"nil", nil, 0, "TRUE", nil},
+		{"empty and", And(), 0, "TRUE", nil},
+		{"single", Eq("status", "active"), 0, "status = $1", []any{"active"}},
+		{
+			"offset",
+			And(Eq("a", 1), Gt("b", 2)),
+			3,
+			"(a = $4 AND b > $5)",
+			[]any{1, 2},
+		},
+		{
+			"optional predicates disappear",
+			And(OptEq("name", none), OptIn[int]("id", nil), OptContains("title", none), When(false, Eq("x", 1)), nil, Eq("y", 2)),
+			0,
+			"y = $1",
+			[]any{2},
+		},
+		{
+			"optional predicates present",
+			And(OptEq("name", &name), OptIn("id", []int{}), When(true, IsNull("deleted_at"))),
+			0,
+			"(name = $1 AND id = ANY($2) AND deleted_at IS NULL)",
+			[]any{"bob", []int{}},
+		},
+		{
+			"nested",
+			Or(Eq("a", 1), Not(And(Lte("b", 2), IsNotNull("c")))),
+			0,
+			"(a = $1 OR NOT ((b <= $2 AND c IS NOT NULL)))",
+			[]any{1, 2},
+		},
+		{"not of empty", Not(And()), 0, "TRUE", nil},
+		{"open range", Range("created_at", &from, nil), 0, "created_at >= $1", []any{from}},
+		{"unbounded range", Range[time.Time]("created_at", nil, nil), 0, "TRUE", nil},
+		{"contains", Contains("title", `50%_off\`), 0, "title ILIKE $1", []any{`%50\%\_off\\%`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args := Build(tt.p, tt.offset)
+			if sql != tt.wantSQL {
+				t.Errorf("sql = %q, want %q", sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package filter
+
+import (
+	"strings"
+
+	"github.com/nghiatrann0502/kyra-kit/errors"
+)
+
+// ===============================
+// Sort allowlist
+// ===============================
+
+// Sorts maps user-facing sort fields to the SQL columns they may order by.
+// Anything not in the map is rejected.
+type Sorts map[string]string
+
+// OrderBy parses a comma-separated sort spec such as "-created_at,name",
+// where a leading '-' means descending, into an ORDER BY list without the
+// keyword. An empty spec yields def.
+func (s Sorts) OrderBy(spec, def string) (string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return def, nil
+	}
+
+	fields := strings.Split(spec, ",")
+	out := make([]string, 0, len(fields))
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		dir := " ASC"
+		if name, ok := strings.CutPrefix(f, "-"); ok {
+			f, dir = name, " DESC"
+		} else {
+			f = strings.TrimPrefix(f, "+")
+		}
+
+		col, ok := s[f]
+		if !ok {
+			return "", errors.Newf(errors.ErrCodeInvalidInput, "unsupported sort field %q", f).
+				WithField("sort", f)
+		}
+		out = append(out, col+dir)
+	}
+
+	return strings.Join(out, ", "), nil
+}
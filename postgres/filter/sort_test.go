@@ -0,0 +1,45 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/nghiatrann0502/kyra-kit/errors"
+)
+
+func TestOrderBy(t *testing.T) {
+	sorts := Sorts{"created_at": "o.created_at", "name": "lower(o.name)"}
+
+	tests := []struct {
+		spec, want string
+	}{
+		{"", "o.id DESC"},
+		{"  ", "o.id DESC"},
+		{"name", "lower(o.name) ASC"},
+		{"+name", "lower(o.name) ASC"},
+		{"-created_at, name", "o.created_at DESC, lower(o.name) ASC"},
+	}
+	for _, tt := range tests {
+		got, err := sorts.OrderBy(tt.spec, "o.id DESC")
+		if err != nil {
+			t.Errorf("OrderBy(%q): %v", tt.spec, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("OrderBy(%q) = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestOrderByRejectsUnknownField(t *testing.T) {
+	sorts := Sorts{"name": "name"}
+	for _, spec := range []string{"password", "name,-password", "name;drop table x", "name,"} {
+		_, err := sorts.OrderBy(spec, "")
+		if err == nil {
+			t.Errorf("OrderBy(%q) succeeded, want error", spec)
+			continue
+		}
+		if code := errors.GetCode(err); code != errors.ErrCodeInvalidInput {
+			t.Errorf("OrderBy(%q) code = %d, want %d", spec, code, errors.ErrCodeInvalidInput)
+		}
+	}
+}
@@ -1,11 +1,41 @@
 package postgres
 
 import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Conn is a connection held out of the pool, for work that depends on
+// session state such as session advisory locks or temporary tables.
+type Conn interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error)
+
+	// Release returns the connection to the pool.
+	Release()
+	// Destroy closes the connection instead, for when session state left on
+	// it cannot be cleaned up.
+	Destroy(ctx context.Context) error
+}
+
 type DBEngine interface {
+	// Exec, Query and QueryRow run on a pooled connection with the settings
+	// in ctx applied, and fail if they cannot be.
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	// Acquire holds a pooled connection, with the settings in ctx applied,
+	// until it is released or destroyed.
+	Acquire(ctx context.Context) (Conn, error)
+
 	GetDB() *pgxpool.Pool
+	BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error)
 	Configure(...Option) DBEngine
 	Close()
+	Shutdown(ctx context.Context) error
 }
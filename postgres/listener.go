@@ -0,0 +1,262 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	_defaultListenMinBackoff = 500 * time.Millisecond
+	_defaultListenMaxBackoff = 30 * time.Second
+)
+
+type Notification struct {
+	Channel string
+	Payload string
+	PID     uint32
+	// Gap is set on a synthetic notification sent after the listener had to
+	// reconnect. Anything published while it was down is lost, so handlers
+	// should resync their state.
+	Gap bool
+}
+
+type NotificationHandler func(ctx context.Context, n Notification)
+
+type ListenerOption func(*Listener)
+
+// ListenBackoff bounds the delay between reconnect attempts. min must be
+// positive and max at least min.
+func ListenBackoff(min, max time.Duration) ListenerOption {
+	return func(l *Listener) {
+		l.minBackoff = min
+		l.maxBackoff = max
+	}
+}
+
+// Listener receives LISTEN/NOTIFY messages on a dedicated connection outside
+// the pool. It reconnects with exponential backoff and re-issues LISTEN for
+// every subscribed channel.
+type Listener struct {
+	connect    func(ctx context.Context) (listenConn, error)
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu       sync.Mutex
+	handlers map[string][]NotificationHandler
+	subs     map[string][]chan Notification
+	wake     chan struct{}
+}
+
+// listenConn is the part of *pgx.Conn the listener uses.
+type listenConn interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+	IsClosed() bool
+	Close(ctx context.Context) error
+}
+
+func NewListener(db DBEngine, opts ...ListenerOption) (*Listener, error) {
+	l := &Listener{
+		connect: func(ctx context.Context) (listenConn, error) {
+			return DedicatedConn(ctx, db)
+		},
+		minBackoff: _defaultListenMinBackoff,
+		maxBackoff: _defaultListenMaxBackoff,
+		handlers:   make(map[string][]NotificationHandler),
+		subs:       make(map[string][]chan Notification),
+		wake:       make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.minBackoff <= 0 || l.maxBackoff < l.minBackoff {
+		return nil, fmt.Errorf("postgres: listener backoff must satisfy 0 < min <= max, got %s and %s",
+			l.minBackoff, l.maxBackoff)
+	}
+
+	return l, nil
+}
+
+// Handle registers h for channel. Handlers run sequentially on the listener
+// goroutine and should not block for long. It is safe to call while Run is
+// active.
+func (l *Listener) Handle(channel string, h NotificationHandler) {
+	l.mu.Lock()
+	l.handlers[channel] = append(l.handlers[channel], h)
+	l.mu.Unlock()
+
+	l.notify()
+}
+
+// Subscribe delivers notifications for channel to a Go channel, which is
+// closed when Run returns. The subscription ends with it; a later Run does
+// not feed the channel. A full buffer blocks the listener.
+func (l *Listener) Subscribe(channel string, buffer int) <-chan Notification {
+	ch := make(chan Notification, buffer)
+
+	l.mu.Lock()
+	l.subs[channel] = append(l.subs[channel], ch)
+	l.mu.Unlock()
+
+	l.notify()
+
+	return ch
+}
+
+// notify wakes the listener to LISTEN on new channels.
+func (l *Listener) notify() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run listens until ctx is done. Handlers registered with Handle stay
+// registered, so Run may be called again afterwards.
+func (l *Listener) Run(ctx context.Context) error {
+	defer l.closeSubs()
+
+	backoff := l.minBackoff
+	resumed := false
+	for {
+		established, err := l.session(ctx, resumed)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if established {
+			resumed = true
+			backoff = l.minBackoff
+		}
+
+		slog.WarnContext(ctx, "postgres listener disconnected", "error", err, "retry_in", backoff)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, l.maxBackoff)
+	}
+}
+
+func (l *Listener) session(ctx context.Context, resumed bool) (bool, error) {
+	conn, err := l.connect(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = conn.Close(closeCtx)
+	}()
+
+	listening := make(map[string]bool)
+	if err := l.listenPending(ctx, conn, listening); err != nil {
+		return false, err
+	}
+	if resumed {
+		for channel := range listening {
+			l.dispatch(ctx, Notification{Channel: channel, Gap: true})
+		}
+	}
+
+	for {
+		if err := l.listenPending(ctx, conn, listening); err != nil {
+			return true, err
+		}
+
+		n, err := l.wait(ctx, conn)
+		if err != nil {
+			if ctx.Err() != nil || conn.IsClosed() {
+				return true, err
+			}
+			// Woken up to subscribe to a new channel.
+			continue
+		}
+
+		l.dispatch(ctx, *n)
+	}
+}
+
+func (l *Listener) listenPending(ctx context.Context, conn listenConn, listening map[string]bool) error {
+	l.mu.Lock()
+	var pending []string
+	for channel := range l.handlers {
+		if !listening[channel] {
+			pending = append(pending, channel)
+		}
+	}
+	for channel := range l.subs {
+		if _, ok := l.handlers[channel]; !ok && !listening[channel] {
+			pending = append(pending, channel)
+		}
+	}
+	l.mu.Unlock()
+
+	for _, channel := range pending {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return err
+		}
+		listening[channel] = true
+	}
+
+	return nil
+}
+
+func (l *Listener) wait(ctx context.Context, conn listenConn) (*Notification, error) {
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-l.wake:
+			cancel()
+		case <-waitCtx.Done():
+		}
+	}()
+
+	n, err := conn.WaitForNotification(waitCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Notification{Channel: n.Channel, Payload: n.Payload, PID: n.PID}, nil
+}
+
+func (l *Listener) dispatch(ctx context.Context, n Notification) {
+	l.mu.Lock()
+	handlers := append([]NotificationHandler(nil), l.handlers[n.Channel]...)
+	subs := append([]chan Notification(nil), l.subs[n.Channel]...)
+	l.mu.Unlock()
+
+	for _, h := range handlers {
+		h(ctx, n)
+	}
+	// Subscriptions are only closed by this goroutine, after the last
+	// dispatch, so the sends cannot race with close.
+	for _, ch := range subs {
+		select {
+		case ch <- n:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// closeSubs ends every subscription.
+func (l *Listener) closeSubs() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, chs := range l.subs {
+		for _, ch := range chs {
+			close(ch)
+		}
+	}
+	clear(l.subs)
+}
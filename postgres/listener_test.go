@@ -0,0 +1,223 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// fakeListenConn delivers what is sent on notes; closing notes drops the
+// connection.
+type fakeListenConn struct {
+	notes chan *pgconn.Notification
+
+	mu      sync.Mutex
+	listens []string
+	closed  bool
+}
+
+func newFakeListenConn() *fakeListenConn {
+	return &fakeListenConn{notes: make(chan *pgconn.Notification)}
+}
+
+func (c *fakeListenConn) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listens = append(c.listens, sql)
+	return pgconn.NewCommandTag("LISTEN"), nil
+}
+
+func (c *fakeListenConn) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	select {
+	case n, ok := <-c.notes:
+		if !ok {
+			c.mu.Lock()
+			c.closed = true
+			c.mu.Unlock()
+			return nil, io.ErrUnexpectedEOF
+		}
+		return n, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *fakeListenConn) IsClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+func (c *fakeListenConn) Close(context.Context) error { return nil }
+
+func (c *fakeListenConn) listened() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Sorted(slices.Values(c.listens))
+}
+
+// newTestListener returns a listener that connects to conns in order.
+func newTestListener(t *testing.T, conns ...*fakeListenConn) *Listener {
+	t.Helper()
+	l, err := NewListener(nil, ListenBackoff(time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := make(chan *fakeListenConn, len(conns))
+	for _, c := range conns {
+		next <- c
+	}
+	l.connect = func(ctx context.Context) (listenConn, error) {
+		select {
+		case c := <-next:
+			return c, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return l
+}
+
+// run starts l.Run and returns a function that stops it and returns its error.
+func run(l *Listener) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- l.Run(ctx) }()
+	return func() error {
+		cancel()
+		return <-done
+	}
+}
+
+func receive(t *testing.T, ch <-chan Notification) Notification {
+	t.Helper()
+	select {
+	case n := <-ch:
+		return n
+	case <-time.After(time.Second):
+		t.Fatal("no notification")
+		return Notification{}
+	}
+}
+
+func TestNewListenerValidatesBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		min, max time.Duration
+	}{
+		{"zero min", 0, time.Second},
+		{"negative min", -time.Second, time.Second},
+		{"max below min", time.Second, time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewListener(nil, ListenBackoff(tt.min, tt.max)); err == nil {
+				t.Error("NewListener accepted the backoff")
+			}
+		})
+	}
+	if _, err := NewListener(nil); err != nil {
+		t.Errorf("defaults: %v", err)
+	}
+}
+
+func TestListenerDispatches(t *testing.T) {
+	conn := newFakeListenConn()
+	l := newTestListener(t, conn)
+
+	handled := make(chan Notification, 1)
+	l.Handle("orders", func(_ context.Context, n Notification) { handled <- n })
+	sub := l.Subscribe("jobs", 1)
+	stop := run(l)
+
+	conn.notes <- &pgconn.Notification{Channel: "orders", Payload: "1", PID: 7}
+	if n := receive(t, handled); n != (Notification{Channel: "orders", Payload: "1", PID: 7}) {
+		t.Errorf("handler got %+v", n)
+	}
+	conn.notes <- &pgconn.Notification{Channel: "jobs", Payload: "2"}
+	if n := receive(t, sub); n.Payload != "2" {
+		t.Errorf("subscriber got %+v", n)
+	}
+
+	if err := stop(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run = %v, want context.Canceled", err)
+	}
+	if _, ok := <-sub; ok {
+		t.Error("subscription not closed when Run returned")
+	}
+	if got, want := conn.listened(), []string{`LISTEN "jobs"`, `LISTEN "orders"`}; !slices.Equal(got, want) {
+		t.Errorf("listened = %v, want %v", got, want)
+	}
+}
+
+func TestListenerListensOnLateHandle(t *testing.T) {
+	conn := newFakeListenConn()
+	l := newTestListener(t, conn)
+	stop := run(l)
+	defer stop()
+
+	sub := l.Subscribe("late", 1)
+	conn.notes <- &pgconn.Notification{Channel: "late", Payload: "x"}
+	if n := receive(t, sub); n.Payload != "x" {
+		t.Errorf("subscriber got %+v", n)
+	}
+	if got := conn.listened(); !slices.Equal(got, []string{`LISTEN "late"`}) {
+		t.Errorf("listened = %v", got)
+	}
+}
+
+func TestListenerReconnectSendsGap(t *testing.T) {
+	first, second := newFakeListenConn(), newFakeListenConn()
+	l := newTestListener(t, first, second)
+
+	handled := make(chan Notification, 1)
+	l.Handle("orders", func(_ context.Context, n Notification) { handled <- n })
+	stop := run(l)
+	defer stop()
+
+	close(first.notes)
+	if n := receive(t, handled); n != (Notification{Channel: "orders", Gap: true}) {
+		t.Errorf("after reconnect got %+v, want a gap", n)
+	}
+	second.notes <- &pgconn.Notification{Channel: "orders", Payload: "1"}
+	if n := receive(t, handled); n.Payload != "1" {
+		t.Errorf("handler got %+v", n)
+	}
+	if got := second.listened(); !slices.Equal(got, []string{`LISTEN "orders"`}) {
+		t.Errorf("listened again = %v", got)
+	}
+}
+
+func TestListenerRunAgain(t *testing.T) {
+	first, second := newFakeListenConn(), newFakeListenConn()
+	l := newTestListener(t, first, second)
+
+	handled := make(chan Notification, 1)
+	l.Handle("orders", func(_ context.Context, n Notification) { handled <- n })
+	sub := l.Subscribe("jobs", 1)
+	stop := run(l)
+	first.notes <- &pgconn.Notification{Channel: "orders"}
+	receive(t, handled)
+	_ = stop()
+	if _, ok := <-sub; ok {
+		t.Fatal("subscription not closed")
+	}
+
+	// The closed subscription must not be sent to by the next Run.
+	stop = run(l)
+	defer stop()
+	second.notes <- &pgconn.Notification{Channel: "jobs"}
+	second.notes <- &pgconn.Notification{Channel: "orders", Payload: "again"}
+	if n := receive(t, handled); n.Payload != "again" {
+		t.Errorf("handler got %+v", n)
+	}
+	if got := second.listened(); !slices.Equal(got, []string{`LISTEN "orders"`}) {
+		t.Errorf("listened = %v, want only the handled channel", got)
+	}
+}
@@ -1,6 +1,10 @@
 package postgres
 
-import "time"
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
 
 type Option func(*postgres)
 
@@ -15,3 +19,50 @@ func ConnTimeout(timeout time.Duration) Option {
 		p.connTimeout = timeout
 	}
 }
+
+// RegisterTypes loads the named types (enums, domains, composites, citext,
+// arrays of them, ...) and registers them on every connection. Dependent
+// types such as array types must be listed after their element type, e.g.
+// "mood", "_mood". Pool options only take effect when passed to
+// NewPostgresDB.
+func RegisterTypes(names ...string) Option {
+	return func(p *postgres) {
+		p.types.names = append(p.types.names, names...)
+	}
+}
+
+// RegisterCodecs runs hooks against every connection's type map before custom
+// types are loaded, e.g. pgxdecimal.Register or pgxuuid.Register.
+func RegisterCodecs(hooks ...func(*pgtype.Map)) Option {
+	return func(p *postgres) {
+		p.types.hooks = append(p.types.hooks, hooks...)
+	}
+}
+
+// WithCredentials makes every new connection ask provider for its user and
+// password. If provider is also a CredentialsWatcher, the pool is recycled
+// whenever it reports a change.
+func WithCredentials(provider CredentialsProvider) Option {
+	return func(p *postgres) {
+		p.credentials = provider
+	}
+}
+
+// AcquireStackTraces records the full stack of every connection acquire, so
+// that Shutdown can log where leaked connections came from. Meant for debug
+// builds; without it only the first caller outside the kit is recorded.
+func AcquireStackTraces(enabled bool) Option {
+	return func(p *postgres) {
+		p.tracker.stacks = enabled
+	}
+}
+
+// DetectNPlusOne counts the statements run with a context set up by
+// WithQueryStats, or inside tx.WithinTx, and logs a warning with the call
+// site when the same statement shape runs more than threshold times. Meant
+// for development; every query pays for normalizing its SQL.
+func DetectNPlusOne(threshold int) Option {
+	return func(p *postgres) {
+		p.nPlusOne = threshold
+	}
+}
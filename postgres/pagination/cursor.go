@@ -0,0 +1,189 @@
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nghiatrann0502/kyra-kit/errors"
+)
+
+// ===============================
+// Opaque, HMAC-signed cursors
+// ===============================
+
+type cursorDir string
+
+const (
+	dirNext cursorDir = "n"
+	dirPrev cursorDir = "p"
+)
+
+type cursorKey struct {
+	T string `json:"t"`
+	V string `json:"v,omitempty"`
+}
+
+type cursorPayload struct {
+	Spec string      `json:"s"`
+	Dir  cursorDir   `json:"d"`
+	Keys []cursorKey `json:"k"`
+}
+
+type cursor struct {
+	dir  cursorDir
+	keys []any
+}
+
+func errInvalidCursor() *errors.Error {
+	return errors.New(errors.ErrCodeInvalidInput, "invalid cursor")
+}
+
+func (p *Paginator) encodeCursor(dir cursorDir, keys []any) (string, error) {
+	payload := cursorPayload{Spec: p.specID, Dir: dir, Keys: make([]cursorKey, 0, len(keys))}
+	for _, k := range keys {
+		ck, err := encodeKey(k)
+		if err != nil {
+			return "", err
+		}
+		payload.Keys = append(payload.Keys, ck)
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	body := base64.RawURLEncoding.EncodeToString(raw)
+	return body + "." + base64.RawURLEncoding.EncodeToString(p.sign(body)), nil
+}
+
+func (p *Paginator) decodeCursor(token string) (*cursor, error) {
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errInvalidCursor()
+	}
+
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotSig, p.sign(body)) {
+		return nil, errInvalidCursor()
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, errInvalidCursor()
+	}
+
+	var payload cursorPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, errInvalidCursor()
+	}
+	if payload.Spec != p.specID || len(payload.Keys) != len(p.columns) {
+		return nil, errInvalidCursor()
+	}
+	if payload.Dir != dirNext && payload.Dir != dirPrev {
+		return nil, errInvalidCursor()
+	}
+
+	c := &cursor{dir: payload.Dir, keys: make([]any, 0, len(payload.Keys))}
+	for i, ck := range payload.Keys {
+		v, err := decodeKey(ck)
+		if err != nil {
+			return nil, errInvalidCursor()
+		}
+		if v == nil && !p.columns[i].Nullable {
+			return nil, errInvalidCursor()
+		}
+		c.keys = append(c.keys, v)
+	}
+
+	return c, nil
+}
+
+func (p *Paginator) sign(body string) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
+
+// Keys are tagged with their Go type so they round-trip losslessly; JSON
+// numbers alone would turn int64 keys into float64.
+func encodeKey(v any) (cursorKey, error) {
+	// Nullable columns are usually scanned into pointers.
+	orig := v
+	for rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer; rv = rv.Elem() {
+		if rv.IsNil() {
+			return cursorKey{T: "null"}, nil
+		}
+		v = rv.Elem().Interface()
+	}
+
+	switch k := v.(type) {
+	case nil:
+		return cursorKey{T: "null"}, nil
+	case string:
+		return cursorKey{T: "s", V: k}, nil
+	case bool:
+		return cursorKey{T: "b", V: strconv.FormatBool(k)}, nil
+	case int:
+		return cursorKey{T: "i", V: strconv.FormatInt(int64(k), 10)}, nil
+	case int16:
+		return cursorKey{T: "i", V: strconv.FormatInt(int64(k), 10)}, nil
+	case int32:
+		return cursorKey{T: "i", V: strconv.FormatInt(int64(k), 10)}, nil
+	case int64:
+		return cursorKey{T: "i", V: strconv.FormatInt(k, 10)}, nil
+	case float32:
+		return cursorKey{T: "f", V: strconv.FormatFloat(float64(k), 'g', -1, 32)}, nil
+	case float64:
+		return cursorKey{T: "f", V: strconv.FormatFloat(k, 'g', -1, 64)}, nil
+	case time.Time:
+		return cursorKey{T: "t", V: k.Format(time.RFC3339Nano)}, nil
+	case []byte:
+		return cursorKey{T: "x", V: base64.RawURLEncoding.EncodeToString(k)}, nil
+	case encoding.TextMarshaler:
+		return marshalTextKey(k)
+	default:
+		// MarshalText may have a pointer receiver, as on *big.Int.
+		if m, ok := orig.(encoding.TextMarshaler); ok {
+			return marshalTextKey(m)
+		}
+		return cursorKey{}, fmt.Errorf("pagination: unsupported key type %T", orig)
+	}
+}
+
+func marshalTextKey(m encoding.TextMarshaler) (cursorKey, error) {
+	text, err := m.MarshalText()
+	if err != nil {
+		return cursorKey{}, err
+	}
+	return cursorKey{T: "s", V: string(text)}, nil
+}
+
+func decodeKey(k cursorKey) (any, error) {
+	switch k.T {
+	case "null":
+		return nil, nil
+	case "s":
+		return k.V, nil
+	case "b":
+		return strconv.ParseBool(k.V)
+	case "i":
+		return strconv.ParseInt(k.V, 10, 64)
+	case "f":
+		return strconv.ParseFloat(k.V, 64)
+	case "t":
+		return time.Parse(time.RFC3339Nano, k.V)
+	case "x":
+		return base64.RawURLEncoding.DecodeString(k.V)
+	default:
+		return nil, fmt.Errorf("pagination: unknown key tag %q", k.T)
+	}
+}
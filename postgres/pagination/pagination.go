@@ -0,0 +1,342 @@
+package pagination
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	_defaultLimit = 20
+	_maxLimit     = 100
+)
+
+// ===============================
+// Sort spec
+// ===============================
+
+type Nulls int
+
+const (
+	// NullsDefault follows Postgres: NULLS LAST for ASC, NULLS FIRST for DESC.
+	NullsDefault Nulls = iota
+	NullsFirst
+	NullsLast
+)
+
+type Column struct {
+	Name     string
+	Desc     bool
+	Nullable bool
+	Nulls    Nulls
+}
+
+func Asc(name string) Column  { return Column{Name: name} }
+func Desc(name string) Column { return Column{Name: name, Desc: true} }
+
+// Null marks the column as nullable with the given NULLS placement.
+func (c Column) Null(n Nulls) Column {
+	c.Nullable = true
+	c.Nulls = n
+	return c
+}
+
+func (c Column) nullsFirst() bool {
+	switch c.Nulls {
+	case NullsFirst:
+		return true
+	case NullsLast:
+		return false
+	default:
+		return c.Desc
+	}
+}
+
+func (c Column) reversed() Column {
+	r := c
+	r.Desc = !c.Desc
+	if c.nullsFirst() {
+		r.Nulls = NullsLast
+	} else {
+		r.Nulls = NullsFirst
+	}
+	return r
+}
+
+func (c Column) orderBy() string {
+	var sb strings.Builder
+	sb.WriteString(c.Name)
+	if c.Desc {
+		sb.WriteString(" DESC")
+	} else {
+		sb.WriteString(" ASC")
+	}
+	if c.Nullable {
+		if c.nullsFirst() {
+			sb.WriteString(" NULLS FIRST")
+		} else {
+			sb.WriteString(" NULLS LAST")
+		}
+	}
+	return sb.String()
+}
+
+// ===============================
+// Paginator
+// ===============================
+
+type Option func(*Paginator)
+
+// DefaultLimit sets the page size used when a request asks for none. It must
+// be positive and no larger than the MaxLimit.
+func DefaultLimit(n int) Option {
+	return func(p *Paginator) {
+		p.defaultLimit = n
+	}
+}
+
+// MaxLimit caps the page size a request can ask for. It must be positive.
+func MaxLimit(n int) Option {
+	return func(p *Paginator) {
+		p.maxLimit = n
+	}
+}
+
+type Paginator struct {
+	columns      []Column
+	secret       []byte
+	specID       string
+	defaultLimit int
+	maxLimit     int
+}
+
+// New returns a Paginator for the given sort spec. The last column must be
+// unique (usually the primary key) so that every row has a distinct position.
+func New(secret []byte, columns []Column, opts ...Option) (*Paginator, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("pagination: secret is required")
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("pagination: at least one sort column is required")
+	}
+
+	h := sha256.New()
+	for _, c := range columns {
+		if c.Name == "" {
+			return nil, errors.New("pagination: empty column name")
+		}
+		fmt.Fprintf(h, "%s|%t|%t|%t;", c.Name, c.Desc, c.Nullable, c.nullsFirst())
+	}
+
+	p := &Paginator{
+		columns:      slices.Clone(columns),
+		secret:       slices.Clone(secret),
+		specID:       hex.EncodeToString(h.Sum(nil)[:8]),
+		defaultLimit: _defaultLimit,
+		maxLimit:     _maxLimit,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.defaultLimit <= 0 || p.maxLimit <= 0 {
+		return nil, fmt.Errorf("pagination: limits must be positive, got default %d and max %d", p.defaultLimit, p.maxLimit)
+	}
+	if p.maxLimit < p.defaultLimit {
+		return nil, fmt.Errorf("pagination: max limit %d is below the default limit %d", p.maxLimit, p.defaultLimit)
+	}
+
+	return p, nil
+}
+
+type Request struct {
+	Cursor string
+	Limit  int
+}
+
+type Query struct {
+	// Where is the keyset predicate, "TRUE" on the first page, so it can be
+	// appended to an existing WHERE clause with AND.
+	Where string
+	// OrderBy is the ORDER BY list without the keyword.
+	OrderBy string
+	Args    []any
+	// Limit is one more than the page size so the next page can be detected.
+	Limit int
+
+	size     int
+	backward bool
+	hasCur   bool
+}
+
+// Build turns a page request into SQL fragments. Placeholders start at
+// argOffset+1 so the fragments can follow the caller's own arguments.
+func (p *Paginator) Build(req Request, argOffset int) (*Query, error) {
+	size := req.Limit
+	if size <= 0 {
+		size = p.defaultLimit
+	}
+	if size > p.maxLimit {
+		size = p.maxLimit
+	}
+
+	q := &Query{Where: "TRUE", Limit: size + 1, size: size}
+
+	columns := p.columns
+	if req.Cursor != "" {
+		cur, err := p.decodeCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		q.hasCur = true
+		q.backward = cur.dir == dirPrev
+		if q.backward {
+			columns = reverse(columns)
+		}
+		q.Where, q.Args = keysetPredicate(columns, cur.keys, argOffset)
+	}
+
+	order := make([]string, 0, len(columns))
+	for _, c := range columns {
+		order = append(order, c.orderBy())
+	}
+	q.OrderBy = strings.Join(order, ", ")
+
+	return q, nil
+}
+
+func reverse(columns []Column) []Column {
+	out := make([]Column, 0, len(columns))
+	for _, c := range columns {
+		out = append(out, c.reversed())
+	}
+	return out
+}
+
+// keysetPredicate builds the row-after-cursor condition:
+//
+//	(c1 > v1) OR (c1 = v1 AND c2 > v2) OR ...
+//
+// with NULL-aware comparisons for nullable columns.
+func keysetPredicate(columns []Column, keys []any, argOffset int) (string, []any) {
+	var args []any
+	placeholders := make([]string, len(keys))
+	for i, k := range keys {
+		if k == nil {
+			continue
+		}
+		args = append(args, k)
+		placeholders[i] = fmt.Sprintf("$%d", argOffset+len(args))
+	}
+
+	var disjuncts []string
+	for i, c := range columns {
+		after, ok := afterExpr(c, keys[i], placeholders[i])
+		if !ok {
+			continue
+		}
+
+		parts := make([]string, 0, i+1)
+		for j := range i {
+			if keys[j] == nil {
+				parts = append(parts, columns[j].Name+" IS NULL")
+			} else {
+				parts = append(parts, columns[j].Name+" = "+placeholders[j])
+			}
+		}
+		if len(parts) == 0 {
+			disjuncts = append(disjuncts, after)
+			continue
+		}
+		parts = append(parts, after)
+		disjuncts = append(disjuncts, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	if len(disjuncts) == 0 {
+		return "FALSE", args
+	}
+	return "(" + strings.Join(disjuncts, " OR ") + ")", args
+}
+
+// afterExpr returns the condition for rows strictly after key in column c,
+// or false when no row can sort after it.
+func afterExpr(c Column, key any, placeholder string) (string, bool) {
+	if key == nil {
+		if c.nullsFirst() {
+			return c.Name + " IS NOT NULL", true
+		}
+		return "", false
+	}
+
+	op := ">"
+	if c.Desc {
+		op = "<"
+	}
+	expr := c.Name + " " + op + " " + placeholder
+	if c.Nullable && !c.nullsFirst() {
+		expr = "(" + expr + " OR " + c.Name + " IS NULL)"
+	}
+	return expr, true
+}
+
+// ===============================
+// Page
+// ===============================
+
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+	PrevCursor string
+	HasNext    bool
+	HasPrev    bool
+}
+
+// NewPage assembles a page from rows fetched with q. keys must return the
+// sort column values of a row, in spec order.
+func NewPage[T any](p *Paginator, q *Query, rows []T, keys func(T) []any) (*Page[T], error) {
+	hasMore := len(rows) > q.size
+	if hasMore {
+		rows = rows[:q.size]
+	}
+	if q.backward {
+		slices.Reverse(rows)
+	}
+
+	page := &Page[T]{Items: rows}
+	// An empty page has no row to issue a cursor from, so it reports
+	// neither direction.
+	if len(rows) == 0 {
+		return page, nil
+	}
+
+	if q.backward {
+		page.HasPrev = hasMore
+		page.HasNext = true
+	} else {
+		page.HasNext = hasMore
+		page.HasPrev = q.hasCur
+	}
+
+	var err error
+	if page.HasNext {
+		if page.NextCursor, err = p.cursorFor(dirNext, keys(rows[len(rows)-1])); err != nil {
+			return nil, err
+		}
+	}
+	if page.HasPrev {
+		if page.PrevCursor, err = p.cursorFor(dirPrev, keys(rows[0])); err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+func (p *Paginator) cursorFor(dir cursorDir, keys []any) (string, error) {
+	if len(keys) != len(p.columns) {
+		return "", fmt.Errorf("pagination: got %d keys, want %d", len(keys), len(p.columns))
+	}
+	return p.encodeCursor(dir, keys)
+}
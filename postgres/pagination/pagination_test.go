@@ -0,0 +1,286 @@
+package pagination
+
+import (
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nghiatrann0502/kyra-kit/errors"
+)
+
+var secret = []byte("test-secret")
+
+func TestKeysetPredicate(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []Column
+		keys    []any
+		want    string
+		args    []any
+	}{
+		{
+			name:    "single ascending",
+			columns: []Column{Asc("id")},
+			keys:    []any{int64(7)},
+			want:    "(id > $3)",
+			args:    []any{int64(7)},
+		},
+		{
+			name:    "descending then tie-breaker",
+			columns: []Column{Desc("created_at"), Asc("id")},
+			keys:    []any{"t", int64(7)},
+			want:    "(created_at < $3 OR (created_at = $3 AND id > $4))",
+			args:    []any{"t", int64(7)},
+		},
+		{
+			name:    "nullable nulls last with value",
+			columns: []Column{Asc("due").Null(NullsLast), Asc("id")},
+			keys:    []any{"d", int64(1)},
+			want:    "((due > $3 OR due IS NULL) OR (due = $3 AND id > $4))",
+			args:    []any{"d", int64(1)},
+		},
+		{
+			name:    "nullable nulls last at null",
+			columns: []Column{Asc("due").Null(NullsLast), Asc("id")},
+			keys:    []any{nil, int64(1)},
+			want:    "((due IS NULL AND id > $3))",
+			args:    []any{int64(1)},
+		},
+		{
+			name:    "nullable nulls first at null",
+			columns: []Column{Asc("due").Null(NullsFirst), Asc("id")},
+			keys:    []any{nil, int64(1)},
+			want:    "(due IS NOT NULL OR (due IS NULL AND id > $3))",
+			args:    []any{int64(1)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args := keysetPredicate(tt.columns, tt.keys, 2)
+			if got != tt.want {
+				t.Errorf("predicate = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestReversed(t *testing.T) {
+	tests := []struct {
+		in   Column
+		want string
+	}{
+		{Asc("a"), "a DESC"},
+		{Desc("a"), "a ASC"},
+		{Asc("a").Null(NullsDefault), "a DESC NULLS FIRST"},
+		{Desc("a").Null(NullsDefault), "a ASC NULLS LAST"},
+		{Asc("a").Null(NullsFirst), "a DESC NULLS LAST"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.in.reversed().orderBy(); got != tt.want {
+			t.Errorf("%s reversed = %q, want %q", tt.in.orderBy(), got, tt.want)
+		}
+	}
+}
+
+func TestEncodeKeyRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)
+	s := "x"
+	tests := []struct {
+		name string
+		in   any
+		want any
+	}{
+		{"nil", nil, nil},
+		{"typed nil time", (*time.Time)(nil), nil},
+		{"typed nil string", (*string)(nil), nil},
+		{"time pointer", &ts, ts},
+		{"string pointer", &s, "x"},
+		{"int", 42, int64(42)},
+		{"int32", int32(-3), int64(-3)},
+		{"float", 1.5, 1.5},
+		{"bool", true, true},
+		{"bytes", []byte{1, 2}, []byte{1, 2}},
+		{"pointer-receiver marshaler", big.NewInt(12), "12"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := encodeKey(tt.in)
+			if err != nil {
+				t.Fatalf("encodeKey: %v", err)
+			}
+			got, err := decodeKey(k)
+			if err != nil {
+				t.Fatalf("decodeKey: %v", err)
+			}
+			if gotTime, ok := got.(time.Time); ok {
+				if !gotTime.Equal(tt.want.(time.Time)) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := encodeKey(struct{}{}); err == nil {
+		t.Error("encodeKey(struct{}{}) succeeded, want an error")
+	}
+}
+
+type row struct {
+	id  int64
+	due *time.Time
+}
+
+func TestPagesWithNullableKeys(t *testing.T) {
+	p, err := New(secret, []Column{Asc("due").Null(NullsLast), Asc("id")}, DefaultLimit(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := func(r row) []any { return []any{r.due, r.id} }
+
+	q, err := p.Build(Request{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Where != "TRUE" || q.Limit != 3 || q.OrderBy != "due ASC NULLS LAST, id ASC" {
+		t.Fatalf("first page query = %+v", q)
+	}
+
+	page, err := NewPage(p, q, []row{{id: 1}, {id: 2}, {id: 3}}, keys)
+	if err != nil {
+		t.Fatalf("NewPage with nil *time.Time keys: %v", err)
+	}
+	if !page.HasNext || page.HasPrev || len(page.Items) != 2 {
+		t.Fatalf("page = %+v", page)
+	}
+
+	next, err := p.Build(Request{Cursor: page.NextCursor}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Where != "((due IS NULL AND id > $2))" || !reflect.DeepEqual(next.Args, []any{int64(2)}) {
+		t.Errorf("next page query = %+v", next)
+	}
+
+	prev, err := NewPage(p, next, []row{{id: 3}}, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := p.Build(Request{Cursor: prev.PrevCursor}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.OrderBy != "due DESC NULLS FIRST, id DESC" {
+		t.Errorf("previous page order = %q", back.OrderBy)
+	}
+}
+
+func TestInvalidCursor(t *testing.T) {
+	p, err := New(secret, []Column{Asc("id")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := New(secret, []Column{Desc("id")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := p.encodeCursor(dirNext, []any{int64(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, sig, _ := strings.Cut(valid, ".")
+	for name, cursor := range map[string]string{
+		"garbage":       "not-a-cursor",
+		"bad signature": body + "." + sig[:len(sig)-2] + "AA",
+		"other spec":    mustCursor(t, other),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := p.Build(Request{Cursor: cursor}, 0)
+			if errors.GetCode(err) != errors.ErrCodeInvalidInput {
+				t.Errorf("err = %v, want invalid input", err)
+			}
+		})
+	}
+}
+
+func mustCursor(t *testing.T, p *Paginator) string {
+	t.Helper()
+	c, err := p.encodeCursor(dirNext, []any{int64(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestLimits(t *testing.T) {
+	p, err := New(secret, []Column{Asc("id")}, DefaultLimit(5), MaxLimit(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ req, want int }{{0, 5}, {3, 3}, {50, 10}} {
+		q, err := p.Build(Request{Limit: tt.req}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.Limit != tt.want+1 {
+			t.Errorf("Limit(%d) = %d, want %d", tt.req, q.Limit, tt.want+1)
+		}
+	}
+}
+
+func TestNewValidatesLimits(t *testing.T) {
+	for name, opts := range map[string][]Option{
+		"zero default":     {DefaultLimit(0)},
+		"negative default": {DefaultLimit(-1)},
+		"zero max":         {MaxLimit(0)},
+		"max below":        {DefaultLimit(20), MaxLimit(10)},
+		"default above":    {DefaultLimit(_maxLimit + 1)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := New(secret, []Column{Asc("id")}, opts...); err == nil {
+				t.Error("New accepted the limits")
+			}
+		})
+	}
+	if _, err := New(secret, []Column{Asc("id")}, DefaultLimit(10), MaxLimit(10)); err != nil {
+		t.Errorf("equal limits: %v", err)
+	}
+}
+
+func TestEmptyPageHasNoCursors(t *testing.T) {
+	p, err := New(secret, []Column{Asc("id")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := func(id int64) []any { return []any{id} }
+
+	for _, dir := range []cursorDir{dirNext, dirPrev} {
+		cursor, err := p.encodeCursor(dir, []any{int64(1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := p.Build(Request{Cursor: cursor}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := NewPage(p, q, []int64{}, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.HasNext || page.HasPrev || page.NextCursor != "" || page.PrevCursor != "" {
+			t.Errorf("empty page after a %q cursor = %+v", dir, page)
+		}
+	}
+}
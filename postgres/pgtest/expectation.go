@@ -0,0 +1,126 @@
+package pgtest
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type kind string
+
+const (
+	kindExec     kind = "Exec"
+	kindQuery    kind = "Query"
+	kindBegin    kind = "Begin"
+	kindCommit   kind = "Commit"
+	kindRollback kind = "Rollback"
+	kindAcquire  kind = "Acquire"
+	kindRelease  kind = "Release"
+	kindDestroy  kind = "Destroy"
+)
+
+// Argument matches a single query argument. Plain values in WithArgs are
+// compared with reflect.DeepEqual.
+type Argument interface {
+	Match(v any) bool
+}
+
+type anyArg struct{}
+
+func (anyArg) Match(any) bool { return true }
+func (anyArg) String() string { return "<any>" }
+
+// AnyArg matches any argument value.
+func AnyArg() Argument { return anyArg{} }
+
+type Expectation struct {
+	kind    kind
+	sql     string
+	re      *regexp.Regexp
+	args    []any
+	hasArgs bool
+	txOpts  *pgx.TxOptions
+
+	rows *Rows
+	tag  pgconn.CommandTag
+	err  error
+
+	triggered bool
+}
+
+// WithArgs sets the arguments the statement must be called with.
+func (e *Expectation) WithArgs(args ...any) *Expectation {
+	e.args = args
+	e.hasArgs = true
+	return e
+}
+
+// WithTxOptions sets the options a Begin must be called with.
+func (e *Expectation) WithTxOptions(opts pgx.TxOptions) *Expectation {
+	e.txOpts = &opts
+	return e
+}
+
+func (e *Expectation) WillReturnRows(rows *Rows) *Expectation {
+	e.rows = rows
+	return e
+}
+
+// WillReturnResult sets the command tag of an Exec, e.g. "UPDATE 1".
+func (e *Expectation) WillReturnResult(tag string) *Expectation {
+	e.tag = pgconn.NewCommandTag(tag)
+	return e
+}
+
+func (e *Expectation) WillReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+func (e *Expectation) String() string {
+	switch {
+	case e.re != nil:
+		return fmt.Sprintf("%s matching %q", e.kind, e.re.String())
+	case e.sql != "":
+		return fmt.Sprintf("%s %q", e.kind, e.sql)
+	default:
+		return string(e.kind)
+	}
+}
+
+func (e *Expectation) matchSQL(sql string) bool {
+	if e.re != nil {
+		return e.re.MatchString(sql)
+	}
+	return normalize(e.sql) == normalize(sql)
+}
+
+func (e *Expectation) matchArgs(args []any) error {
+	if !e.hasArgs {
+		return nil
+	}
+	if len(args) != len(e.args) {
+		return fmt.Errorf("got %d args, want %d", len(args), len(e.args))
+	}
+	for i, want := range e.args {
+		if m, ok := want.(Argument); ok {
+			if !m.Match(args[i]) {
+				return fmt.Errorf("arg $%d: %#v does not match %v", i+1, args[i], m)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(want, args[i]) {
+			return fmt.Errorf("arg $%d: got %#v, want %#v", i+1, args[i], want)
+		}
+	}
+	return nil
+}
+
+// normalize collapses whitespace so expectations can be written across lines.
+func normalize(sql string) string {
+	return strings.Join(strings.Fields(sql), " ")
+}
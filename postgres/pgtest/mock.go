@@ -0,0 +1,424 @@
+package pgtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nghiatrann0502/kyra-kit/postgres"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+// Mock is an in-process stand-in for a database. It implements tx.DBTX and
+// postgres.DBEngine, so it can be handed to repositories and to
+// tx.NewUnitOfWord. Calls must match the scripted expectations in order; any
+// mismatch fails the test.
+//
+// GetDB returns nil: code that needs the pool itself cannot run on a Mock.
+type Mock struct {
+	t testing.TB
+
+	mu           sync.Mutex
+	expectations []*Expectation
+}
+
+var (
+	_ tx.DBTX           = (*Mock)(nil)
+	_ postgres.DBEngine = (*Mock)(nil)
+)
+
+// New returns a Mock that checks for unmet expectations when the test ends.
+func New(t testing.TB) *Mock {
+	m := &Mock{t: t}
+	t.Cleanup(func() {
+		if err := m.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return m
+}
+
+func (m *Mock) expect(e *Expectation) *Expectation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// ExpectExec expects an Exec whose SQL equals sql, ignoring whitespace.
+func (m *Mock) ExpectExec(sql string) *Expectation {
+	return m.expect(&Expectation{kind: kindExec, sql: sql})
+}
+
+// ExpectExecRegexp expects an Exec whose SQL matches pattern.
+func (m *Mock) ExpectExecRegexp(pattern string) *Expectation {
+	return m.expect(&Expectation{kind: kindExec, re: regexp.MustCompile(pattern)})
+}
+
+// ExpectQuery expects a Query or QueryRow whose SQL equals sql, ignoring
+// whitespace.
+func (m *Mock) ExpectQuery(sql string) *Expectation {
+	return m.expect(&Expectation{kind: kindQuery, sql: sql})
+}
+
+// ExpectQueryRegexp expects a Query or QueryRow whose SQL matches pattern.
+func (m *Mock) ExpectQueryRegexp(pattern string) *Expectation {
+	return m.expect(&Expectation{kind: kindQuery, re: regexp.MustCompile(pattern)})
+}
+
+// ExpectBegin expects a transaction, or a savepoint when called on an open
+// transaction.
+func (m *Mock) ExpectBegin() *Expectation {
+	return m.expect(&Expectation{kind: kindBegin})
+}
+
+func (m *Mock) ExpectCommit() *Expectation {
+	return m.expect(&Expectation{kind: kindCommit})
+}
+
+func (m *Mock) ExpectRollback() *Expectation {
+	return m.expect(&Expectation{kind: kindRollback})
+}
+
+// ExpectAcquire expects a connection to be taken from the pool. Calls on the
+// connection are matched against the same expectations as calls on the Mock.
+func (m *Mock) ExpectAcquire() *Expectation {
+	return m.expect(&Expectation{kind: kindAcquire})
+}
+
+// ExpectRelease expects an acquired connection to go back to the pool.
+func (m *Mock) ExpectRelease() *Expectation {
+	return m.expect(&Expectation{kind: kindRelease})
+}
+
+// ExpectDestroy expects an acquired connection to be closed instead of
+// released.
+func (m *Mock) ExpectDestroy() *Expectation {
+	return m.expect(&Expectation{kind: kindDestroy})
+}
+
+// ExpectationsWereMet reports scripted calls that never happened.
+func (m *Mock) ExpectationsWereMet() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pending []string
+	for _, e := range m.expectations {
+		if !e.triggered {
+			pending = append(pending, e.String())
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("pgtest: unmet expectations:\n\t%s", strings.Join(pending, "\n\t"))
+	}
+	return nil
+}
+
+// next consumes the next expectation and checks it against the call. Errors
+// are reported to the test and returned to the caller.
+func (m *Mock) next(k kind, sql string, args []any) (*Expectation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	call := string(k)
+	if sql != "" {
+		call = fmt.Sprintf("%s %q", k, normalize(sql))
+	}
+
+	var e *Expectation
+	for _, candidate := range m.expectations {
+		if !candidate.triggered {
+			e = candidate
+			break
+		}
+	}
+	if e == nil {
+		return nil, m.fail("pgtest: unexpected call %s", call)
+	}
+	if e.kind != k || (sql != "" && !e.matchSQL(sql)) {
+		return nil, m.fail("pgtest: unexpected call %s, next expectation is %s", call, e)
+	}
+	if err := e.matchArgs(args); err != nil {
+		return nil, m.fail("pgtest: %s: %v", call, err)
+	}
+
+	e.triggered = true
+	return e, nil
+}
+
+func (m *Mock) fail(format string, args ...any) error {
+	err := fmt.Errorf(format, args...)
+	m.t.Error(err)
+	return err
+}
+
+// ===============================
+// tx.DBTX
+// ===============================
+
+func (m *Mock) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	record(ctx, sql)
+	e, err := m.next(kindExec, sql, args)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return e.tag, e.err
+}
+
+func (m *Mock) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	record(ctx, sql)
+	e, err := m.next(kindQuery, sql, args)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return newRows(e.rows), nil
+}
+
+func (m *Mock) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	rs, err := m.Query(ctx, sql, args...)
+	if err != nil {
+		return &row{err: err}
+	}
+	return &row{rows: rs.(*rows)}
+}
+
+// record counts sql in the QueryStats of ctx, as the N+1 detector of a real
+// engine would.
+func record(ctx context.Context, sql string) {
+	if s := postgres.QueryStatsFrom(ctx); s != nil {
+		s.Record(sql)
+	}
+}
+
+// AssertMaxQueries fails the test if more than max statements were run with
+// stats, listing them by shape. It counts what a real engine's N+1 detector
+// counts: every Exec, Query and QueryRow, but neither transaction control
+// (BEGIN, COMMIT, ROLLBACK, SAVEPOINT, RELEASE) nor session settings (SET,
+// RESET, set_config), so a test passes or fails the same on both.
+//
+// A real engine only records statements when built with
+// postgres.DetectNPlusOne. Without it stats stays empty, so a positive max
+// with nothing recorded fails rather than passing without having counted
+// anything.
+func AssertMaxQueries(t testing.TB, stats *postgres.QueryStats, max int) {
+	t.Helper()
+	n := stats.Total()
+	if n == 0 && max > 0 {
+		t.Errorf("pgtest: no statements recorded; run them on a Mock or an engine built with postgres.DetectNPlusOne")
+		return
+	}
+	if n > max {
+		var shapes []string
+		for shape, count := range stats.Shapes() {
+			shapes = append(shapes, fmt.Sprintf("%dx %s", count, shape))
+		}
+		sort.Strings(shapes)
+		t.Errorf("pgtest: %d statements run, want at most %d:\n\t%s", n, max, strings.Join(shapes, "\n\t"))
+	}
+}
+
+// ===============================
+// postgres.DBEngine
+// ===============================
+
+func (m *Mock) GetDB() *pgxpool.Pool { return nil }
+
+func (m *Mock) BeginTx(_ context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	e, err := m.next(kindBegin, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if e.txOpts != nil && *e.txOpts != opts {
+		return nil, m.fail("pgtest: Begin with %+v, want %+v", opts, *e.txOpts)
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &mockTx{m: m}, nil
+}
+
+func (m *Mock) Acquire(context.Context) (postgres.Conn, error) {
+	e, err := m.next(kindAcquire, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &mockConn{m: m}, nil
+}
+
+func (m *Mock) Configure(...postgres.Option) postgres.DBEngine { return m }
+
+func (m *Mock) Close() {}
+
+func (m *Mock) Shutdown(context.Context) error { return nil }
+
+// ===============================
+// postgres.Conn
+// ===============================
+
+type mockConn struct {
+	m    *Mock
+	done bool
+}
+
+var _ postgres.Conn = (*mockConn)(nil)
+
+var errConnReleased = errors.New("pgtest: connection already released")
+
+func (c *mockConn) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if c.done {
+		return pgconn.CommandTag{}, c.m.fail("pgtest: Exec %q: %w", sql, errConnReleased)
+	}
+	return c.m.Exec(ctx, sql, args...)
+}
+
+func (c *mockConn) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if c.done {
+		return nil, c.m.fail("pgtest: Query %q: %w", sql, errConnReleased)
+	}
+	return c.m.Query(ctx, sql, args...)
+}
+
+func (c *mockConn) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if c.done {
+		return &row{err: c.m.fail("pgtest: QueryRow %q: %w", sql, errConnReleased)}
+	}
+	return c.m.QueryRow(ctx, sql, args...)
+}
+
+func (c *mockConn) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	if c.done {
+		return nil, c.m.fail("pgtest: Begin: %w", errConnReleased)
+	}
+	return c.m.BeginTx(ctx, opts)
+}
+
+func (c *mockConn) Release() {
+	if c.done {
+		c.m.fail("pgtest: Release: %w", errConnReleased)
+		return
+	}
+	c.done = true
+	c.m.next(kindRelease, "", nil)
+}
+
+func (c *mockConn) Destroy(context.Context) error {
+	if c.done {
+		return c.m.fail("pgtest: Destroy: %w", errConnReleased)
+	}
+	c.done = true
+	e, err := c.m.next(kindDestroy, "", nil)
+	if err != nil {
+		return err
+	}
+	return e.err
+}
+
+// ===============================
+// pgx.Tx
+// ===============================
+
+var errUnsupported = errors.New("pgtest: not supported by the mock")
+
+type mockTx struct {
+	m    *Mock
+	done bool
+}
+
+var _ pgx.Tx = (*mockTx)(nil)
+
+func (t *mockTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	if t.done {
+		return nil, pgx.ErrTxClosed
+	}
+	if _, err := t.m.BeginTx(ctx, pgx.TxOptions{}); err != nil {
+		return nil, err
+	}
+	return &mockTx{m: t.m}, nil
+}
+
+func (t *mockTx) Commit(context.Context) error {
+	if t.done {
+		return pgx.ErrTxClosed
+	}
+	t.done = true
+	e, err := t.m.next(kindCommit, "", nil)
+	if err != nil {
+		return err
+	}
+	return e.err
+}
+
+// Rollback on a finished transaction is a no-op returning pgx.ErrTxClosed, so
+// the usual deferred Rollback after Commit needs no expectation.
+func (t *mockTx) Rollback(context.Context) error {
+	if t.done {
+		return pgx.ErrTxClosed
+	}
+	t.done = true
+	e, err := t.m.next(kindRollback, "", nil)
+	if err != nil {
+		return err
+	}
+	return e.err
+}
+
+func (t *mockTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if t.done {
+		return pgconn.CommandTag{}, pgx.ErrTxClosed
+	}
+	return t.m.Exec(ctx, sql, args...)
+}
+
+func (t *mockTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if t.done {
+		return nil, pgx.ErrTxClosed
+	}
+	return t.m.Query(ctx, sql, args...)
+}
+
+func (t *mockTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if t.done {
+		return &row{err: pgx.ErrTxClosed}
+	}
+	return t.m.QueryRow(ctx, sql, args...)
+}
+
+func (t *mockTx) CopyFrom(context.Context, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error) {
+	return 0, t.m.fail("pgtest: unexpected call CopyFrom: %w", errUnsupported)
+}
+
+func (t *mockTx) SendBatch(context.Context, *pgx.Batch) pgx.BatchResults {
+	return errBatch{err: t.m.fail("pgtest: unexpected call SendBatch: %w", errUnsupported)}
+}
+
+func (t *mockTx) LargeObjects() pgx.LargeObjects {
+	t.m.fail("pgtest: unexpected call LargeObjects: %w", errUnsupported)
+	return pgx.LargeObjects{}
+}
+
+func (t *mockTx) Prepare(context.Context, string, string) (*pgconn.StatementDescription, error) {
+	return nil, t.m.fail("pgtest: unexpected call Prepare: %w", errUnsupported)
+}
+
+func (t *mockTx) Conn() *pgx.Conn { return nil }
+
+type errBatch struct{ err error }
+
+func (b errBatch) Exec() (pgconn.CommandTag, error) { return pgconn.CommandTag{}, b.err }
+func (b errBatch) Query() (pgx.Rows, error)         { return nil, b.err }
+func (b errBatch) QueryRow() pgx.Row                { return &row{err: b.err} }
+func (b errBatch) Close() error                     { return b.err }
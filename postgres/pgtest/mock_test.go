@@ -0,0 +1,84 @@
+package pgtest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nghiatrann0502/kyra-kit/postgres"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+func TestMockCountsQueriesInTransaction(t *testing.T) {
+	m := New(t)
+	m.ExpectBegin()
+	m.ExpectExec("UPDATE users SET name = $1 WHERE id = $2").WithArgs("ann", 1)
+	m.ExpectQuery("SELECT id FROM users WHERE id = $1").WithArgs(1).
+		WillReturnRows(NewRows("id").AddRow(1))
+	m.ExpectCommit()
+
+	ctx, stats := postgres.WithQueryStats(context.Background())
+	err := tx.WithinTx(ctx, tx.NewUnitOfWord(m), func(ctx context.Context) error {
+		t := tx.TxFrom(ctx)
+		if _, err := t.Exec(ctx, "UPDATE users SET name = $1 WHERE id = $2", "ann", 1); err != nil {
+			return err
+		}
+		var id int
+		return t.QueryRow(ctx, "SELECT id FROM users WHERE id = $1", 1).Scan(&id)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := stats.Total(); n != 2 {
+		t.Errorf("Total() = %d, want 2", n)
+	}
+	AssertMaxQueries(t, stats, 2)
+}
+
+// errorRecorder captures what an assertion reports instead of failing t.
+type errorRecorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *errorRecorder) Helper() {}
+
+func (r *errorRecorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertMaxQueries(t *testing.T) {
+	recorded := func(sqls ...string) *postgres.QueryStats {
+		_, stats := postgres.WithQueryStats(context.Background())
+		for _, sql := range sqls {
+			stats.Record(sql)
+		}
+		return stats
+	}
+	tests := []struct {
+		name  string
+		stats *postgres.QueryStats
+		max   int
+		fail  string
+	}{
+		{"within", recorded("SELECT 1", "SELECT 2"), 2, ""},
+		{"over", recorded("SELECT 1", "SELECT 2", "UPDATE t SET a = 1"), 2, "2x select ?"},
+		{"nothing recorded", recorded(), 2, "no statements recorded"},
+		{"none expected", recorded(), 0, ""},
+		{"control statements only", recorded("BEGIN", "COMMIT"), 1, "no statements recorded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &errorRecorder{TB: t}
+			AssertMaxQueries(r, tt.stats, tt.max)
+			switch {
+			case tt.fail == "" && len(r.errors) > 0:
+				t.Errorf("failed: %v", r.errors)
+			case tt.fail != "" && (len(r.errors) != 1 || !strings.Contains(r.errors[0], tt.fail)):
+				t.Errorf("errors = %q, want one containing %q", r.errors, tt.fail)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package pgtest
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Rows is a canned result set. Build it with NewRows or RowsFrom and hand it
+// to Expectation.WillReturnRows.
+type Rows struct {
+	columns []string
+	values  [][]any
+	err     error
+}
+
+func NewRows(columns ...string) *Rows {
+	return &Rows{columns: columns}
+}
+
+// AddRow appends a row; values are matched to columns by position.
+func (r *Rows) AddRow(values ...any) *Rows {
+	r.values = append(r.values, values)
+	return r
+}
+
+// RowError makes iteration fail with err after the rows have been read.
+func (r *Rows) RowError(err error) *Rows {
+	r.err = err
+	return r
+}
+
+// RowsFrom builds rows from a slice of structs (or struct pointers). Column
+// names come from the `db` tag, falling back to the lower-cased field name,
+// the same way pgx.RowToStructByName maps them back.
+func RowsFrom(items any) *Rows {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice {
+		panic(fmt.Sprintf("pgtest: RowsFrom needs a slice, got %T", items))
+	}
+
+	elem := v.Type().Elem()
+	if elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("pgtest: RowsFrom needs a slice of structs, got %T", items))
+	}
+
+	var columns []string
+	var fields []int
+	for i := range elem.NumField() {
+		f := elem.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Tag.Get("db")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		columns = append(columns, name)
+		fields = append(fields, i)
+	}
+
+	rows := NewRows(columns...)
+	for i := range v.Len() {
+		item := reflect.Indirect(v.Index(i))
+		values := make([]any, 0, len(fields))
+		for _, f := range fields {
+			values = append(values, item.Field(f).Interface())
+		}
+		rows.AddRow(values...)
+	}
+
+	return rows
+}
+
+// ===============================
+// pgx.Rows implementation
+// ===============================
+
+type rows struct {
+	src    *Rows
+	pos    int
+	closed bool
+	err    error
+}
+
+var _ pgx.Rows = (*rows)(nil)
+
+func newRows(src *Rows) *rows {
+	if src == nil {
+		src = NewRows()
+	}
+	return &rows{src: src, pos: -1}
+}
+
+func (r *rows) Close() {
+	if r.closed {
+		return
+	}
+	r.closed = true
+	if r.err == nil {
+		r.err = r.src.err
+	}
+}
+
+func (r *rows) Err() error { return r.err }
+
+func (r *rows) CommandTag() pgconn.CommandTag {
+	return pgconn.NewCommandTag(fmt.Sprintf("SELECT %d", len(r.src.values)))
+}
+
+func (r *rows) FieldDescriptions() []pgconn.FieldDescription {
+	fds := make([]pgconn.FieldDescription, 0, len(r.src.columns))
+	for _, c := range r.src.columns {
+		fds = append(fds, pgconn.FieldDescription{Name: c})
+	}
+	return fds
+}
+
+func (r *rows) Next() bool {
+	if r.closed {
+		return false
+	}
+	r.pos++
+	if r.pos >= len(r.src.values) {
+		r.Close()
+		return false
+	}
+	return true
+}
+
+func (r *rows) Scan(dest ...any) error {
+	if r.pos < 0 || r.pos >= len(r.src.values) {
+		return fmt.Errorf("pgtest: Scan called without a current row")
+	}
+	values := r.src.values[r.pos]
+	if len(dest) != len(values) {
+		err := fmt.Errorf("pgtest: got %d scan targets, row has %d values", len(dest), len(values))
+		r.err = err
+		r.Close()
+		return err
+	}
+
+	for i, d := range dest {
+		if err := assign(d, values[i]); err != nil {
+			err = fmt.Errorf("pgtest: column %q: %w", r.src.columns[i], err)
+			r.err = err
+			r.Close()
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *rows) Values() ([]any, error) {
+	if r.pos < 0 || r.pos >= len(r.src.values) {
+		return nil, fmt.Errorf("pgtest: Values called without a current row")
+	}
+	return append([]any(nil), r.src.values[r.pos]...), nil
+}
+
+func (r *rows) RawValues() [][]byte { return nil }
+
+func (r *rows) Conn() *pgx.Conn { return nil }
+
+// row adapts rows to pgx.Row the way pgx does: first row only, ErrNoRows when
+// empty.
+type row struct {
+	rows *rows
+	err  error
+}
+
+func (r *row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return err
+	}
+	r.rows.Close()
+	return r.rows.Err()
+}
+
+// assign stores v into the pointer dest, converting between compatible Go
+// types. nil dest skips the column like pgx does.
+func assign(dest, v any) error {
+	if dest == nil {
+		return nil
+	}
+	if s, ok := dest.(sql.Scanner); ok {
+		return s.Scan(v)
+	}
+
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		return fmt.Errorf("scan target %T is not a non-nil pointer", dest)
+	}
+	target := dv.Elem()
+
+	if v == nil {
+		switch target.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+			target.Set(reflect.Zero(target.Type()))
+			return nil
+		}
+		return fmt.Errorf("cannot scan NULL into %s", target.Type())
+	}
+
+	src := reflect.ValueOf(v)
+	switch {
+	case src.Type().AssignableTo(target.Type()):
+		target.Set(src)
+	case target.Kind() == reflect.Pointer:
+		ptr := reflect.New(target.Type().Elem())
+		if err := assign(ptr.Interface(), v); err != nil {
+			return err
+		}
+		target.Set(ptr)
+	case src.Kind() == reflect.Pointer:
+		if src.IsNil() {
+			return assign(dest, nil)
+		}
+		return assign(dest, src.Elem().Interface())
+	case src.Type().ConvertibleTo(target.Type()) && convertible(src.Kind(), target.Kind()):
+		target.Set(src.Convert(target.Type()))
+	default:
+		return fmt.Errorf("cannot scan %T into %s", v, target.Type())
+	}
+
+	return nil
+}
+
+// convertible rules out the lossy conversions reflect allows, such as an int
+// into a string.
+func convertible(from, to reflect.Kind) bool {
+	isNumber := func(k reflect.Kind) bool {
+		return k >= reflect.Int && k <= reflect.Float64
+	}
+	if isNumber(from) || isNumber(to) {
+		return isNumber(from) && isNumber(to)
+	}
+	return true
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -20,23 +23,48 @@ type DBConnString string
 type postgres struct {
 	connAttempts int
 	connTimeout  time.Duration
+	types        typeRegistry
+	credentials  CredentialsProvider
+	tracker      connTracker
+	settings     sessionSettings
+	nPlusOne     int
+
+	stop         context.CancelFunc
+	shuttingDown atomic.Bool
+	// closePool closes db; Shutdown runs it once in the background and
+	// closes closed when it returns.
+	closePool func()
+	closeOnce sync.Once
+	closed    chan struct{}
 
 	db *pgxpool.Pool
 }
 
 var _ DBEngine = (*postgres)(nil)
 
-func NewPostgresDB(url DBConnString) (DBEngine, error) {
+func NewPostgresDB(url DBConnString, opts ...Option) (DBEngine, error) {
 	pg := &postgres{
 		connAttempts: _defaultConnAttempts,
 		connTimeout:  _defaultConnTimeout,
 	}
+	pg.Configure(opts...)
+
+	cfg, err := pgxpool.ParseConfig(string(url))
+	if err != nil {
+		return nil, fmt.Errorf("parse connection string: %w", err)
+	}
+	installSessionSettings(cfg, &pg.settings)
+	installTypeRegistry(cfg, &pg.types)
+	installCredentials(cfg, pg.credentials)
+	installConnTracker(cfg, &pg.tracker)
+	installNPlusOneDetector(cfg, pg.nPlusOne)
 
-	var err error
 	for pg.connAttempts > 0 {
-		pg.db, err = pgxpool.New(context.Background(), string(url))
+		pg.db, err = pgxpool.NewWithConfig(context.Background(), cfg)
 		if err == nil {
+			pg.closePool = pg.db.Close
 			slog.Info("📰 connected to Postgres 🎉")
+			pg.watchCredentials()
 			return pg, nil
 		}
 
@@ -49,6 +77,17 @@ func NewPostgresDB(url DBConnString) (DBEngine, error) {
 		pg.connAttempts, err)
 }
 
+func (p *postgres) watchCredentials() {
+	w, ok := p.credentials.(CredentialsWatcher)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.stop = cancel
+	go w.Watch(ctx, p.db.Reset)
+}
+
 func (p *postgres) Configure(opts ...Option) DBEngine {
 	for _, opt := range opts {
 		opt(p)
@@ -61,7 +100,19 @@ func (p *postgres) GetDB() *pgxpool.Pool {
 	return p.db
 }
 
+func (p *postgres) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	return p.db.BeginTx(ctx, opts)
+}
+
+// Close closes the pool and blocks until every connection is released. Use
+// Shutdown to bound the wait.
 func (p *postgres) Close() {
+	if p.shuttingDown.Load() {
+		return
+	}
+	if p.stop != nil {
+		p.stop()
+	}
 	if p.db != nil {
 		p.db.Close()
 	}
@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ===============================
+// N+1 detection
+// ===============================
+
+type ctxKeyQueryStats struct{}
+
+// QueryStats counts the statements run with a context, by normalized shape:
+// literals and placeholders are replaced with "?", so the same query with
+// other arguments counts as a repeat. Transaction control (BEGIN, COMMIT,
+// ROLLBACK, SAVEPOINT, RELEASE) and session settings (SET, RESET, set_config)
+// are not counted: they are overhead of how a unit of work is run, not
+// queries the caller issued.
+type QueryStats struct {
+	mu     sync.Mutex
+	total  int
+	shapes map[string]int
+}
+
+// WithQueryStats starts counting the statements run with the returned
+// context, e.g. for the duration of a request. If ctx already counts, its
+// QueryStats is kept so that nested scopes add up.
+func WithQueryStats(ctx context.Context) (context.Context, *QueryStats) {
+	if s := QueryStatsFrom(ctx); s != nil {
+		return ctx, s
+	}
+
+	s := &QueryStats{}
+	return context.WithValue(ctx, ctxKeyQueryStats{}, s), s
+}
+
+func QueryStatsFrom(ctx context.Context) *QueryStats {
+	s, _ := ctx.Value(ctxKeyQueryStats{}).(*QueryStats)
+	return s
+}
+
+// Record counts sql and returns how many times its shape has run so far, or
+// 0 for statements QueryStats does not count. Statements on an engine built
+// with DetectNPlusOne are recorded automatically.
+func (s *QueryStats) Record(sql string) int {
+	shape := NormalizeQuery(sql)
+	if controlStatement.MatchString(shape) {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shapes == nil {
+		s.shapes = make(map[string]int)
+	}
+	s.total++
+	s.shapes[shape]++
+
+	return s.shapes[shape]
+}
+
+func (s *QueryStats) Total() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+// Shapes returns the count of every normalized statement.
+func (s *QueryStats) Shapes() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]int, len(s.shapes))
+	for k, v := range s.shapes {
+		out[k] = v
+	}
+	return out
+}
+
+var (
+	stringLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+	placeholder   = regexp.MustCompile(`\$\d+`)
+	numberLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	valueList     = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	whitespace    = regexp.MustCompile(`\s+`)
+
+	controlStatement = regexp.MustCompile(`^(?:(?:begin|start transaction|commit|end|rollback|abort|savepoint|release|prepare transaction|set|reset)\b|select set_config\()`)
+)
+
+// NormalizeQuery returns the shape of sql used by QueryStats.
+func NormalizeQuery(sql string) string {
+	sql = stringLiteral.ReplaceAllString(sql, "?")
+	sql = placeholder.ReplaceAllString(sql, "?")
+	sql = numberLiteral.ReplaceAllString(sql, "?")
+	sql = valueList.ReplaceAllString(sql, "(?)")
+	sql = whitespace.ReplaceAllString(sql, " ")
+	return strings.ToLower(strings.TrimSpace(sql))
+}
+
+// nPlusOneTracer records every query in the QueryStats of its context and
+// warns when a shape repeats more than threshold times.
+type nPlusOneTracer struct {
+	threshold int
+	next      pgx.QueryTracer
+}
+
+func installNPlusOneDetector(cfg *pgxpool.Config, threshold int) {
+	if threshold <= 0 {
+		return
+	}
+
+	t := &nPlusOneTracer{threshold: threshold}
+	if next, ok := cfg.ConnConfig.Tracer.(pgx.QueryTracer); ok {
+		t.next = next
+	}
+	cfg.ConnConfig.Tracer = t
+}
+
+func (t *nPlusOneTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if s := QueryStatsFrom(ctx); s != nil {
+		// Warn once per shape, when it crosses the threshold.
+		if n := s.Record(data.SQL); n == t.threshold+1 {
+			slog.WarnContext(ctx, "postgres: possible N+1 query",
+				"query", NormalizeQuery(data.SQL),
+				"count", n,
+				"caller", externalCaller())
+		}
+	}
+
+	if t.next != nil {
+		return t.next.TraceQueryStart(ctx, conn, data)
+	}
+	return ctx
+}
+
+func (t *nPlusOneTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	if t.next != nil {
+		t.next.TraceQueryEnd(ctx, conn, data)
+	}
+}
+
+// externalCaller returns the first frame on the stack outside the kit and
+// pgx.
+func externalCaller() string {
+	var pcs [32]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if !isInternalFrame(f.Function) {
+			return fmt.Sprintf("%s (%s:%d)", f.Function, f.File, f.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
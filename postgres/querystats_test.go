@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct {
+		sql, want string
+	}{
+		{"SELECT * FROM users WHERE id = $1", "select * from users where id = ?"},
+		{"SELECT * FROM users WHERE id = 42", "select * from users where id = ?"},
+		{"SELECT * FROM users WHERE name = 'O''Brien'", "select * from users where name = ?"},
+		{"SELECT * FROM t WHERE id IN ($1, $2,$3)", "select * from t where id in (?)"},
+		{"SELECT * FROM t WHERE id IN (1)", "select * from t where id in (?)"},
+		{"INSERT INTO t2 (a, b)\n\tVALUES ($1, 2.5)", "insert into t2 (a, b) values (?)"},
+		{"  SELECT\n  1  ", "select ?"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeQuery(tt.sql); got != tt.want {
+			t.Errorf("NormalizeQuery(%q) = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestQueryStatsSkipsControlStatements(t *testing.T) {
+	_, s := WithQueryStats(context.Background())
+	for _, sql := range []string{
+		"begin",
+		"BEGIN ISOLATION LEVEL SERIALIZABLE",
+		"savepoint sp_1",
+		"release savepoint sp_1",
+		"rollback to savepoint sp_1",
+		"SET LOCAL statement_timeout = '5s'",
+		"SELECT set_config(s.name, s.value, $3) FROM unnest($1::text[], $2::text[]) AS s(name, value)",
+		"commit",
+	} {
+		if n := s.Record(sql); n != 0 {
+			t.Errorf("Record(%q) = %d, want 0", sql, n)
+		}
+	}
+
+	s.Record("SELECT * FROM settings WHERE id = $1")
+	s.Record("SELECT * FROM settings WHERE id = $1")
+	if n := s.Total(); n != 2 {
+		t.Errorf("Total() = %d, want 2", n)
+	}
+}
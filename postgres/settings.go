@@ -0,0 +1,196 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ===============================
+// Per-request session settings
+// ===============================
+
+type Setting struct {
+	Name  string
+	Value string
+}
+
+type ctxKeySettings struct{}
+
+var settingNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// WithSetting returns a context that carries the run-time parameter name,
+// e.g. "app.tenant_id" for row-level security policies. The kit applies it
+// with SET LOCAL inside tx.WithinTx, and for the duration of a pool
+// acquisition otherwise; a value the server rejects is reported by
+// tx.WithinTx and the engine's Exec, Query and QueryRow. name must be a
+// literal parameter name, optionally qualified; anything else is an error.
+func WithSetting(ctx context.Context, name, value string) (context.Context, error) {
+	if !settingNameRe.MatchString(name) {
+		return ctx, fmt.Errorf("postgres: invalid setting name %q", name)
+	}
+	return withSetting(ctx, name, value), nil
+}
+
+// withSetting is WithSetting for names known to be valid.
+func withSetting(ctx context.Context, name, value string) context.Context {
+	prev := SettingsFrom(ctx)
+	next := make([]Setting, 0, len(prev)+1)
+	for _, s := range prev {
+		if s.Name != name {
+			next = append(next, s)
+		}
+	}
+	next = append(next, Setting{Name: name, Value: value})
+
+	return context.WithValue(ctx, ctxKeySettings{}, next)
+}
+
+// WithStatementTimeout sets statement_timeout to d, rounded up to whole
+// milliseconds so that a positive d never turns into 0, which Postgres reads
+// as no timeout.
+func WithStatementTimeout(ctx context.Context, d time.Duration) context.Context {
+	ms := d.Milliseconds()
+	if d%time.Millisecond > 0 {
+		ms++
+	}
+	return withSetting(ctx, "statement_timeout", strconv.FormatInt(ms, 10))
+}
+
+func WithSearchPath(ctx context.Context, schemas ...string) context.Context {
+	quoted := make([]string, 0, len(schemas))
+	for _, s := range schemas {
+		quoted = append(quoted, pgx.Identifier{s}.Sanitize())
+	}
+	return withSetting(ctx, "search_path", strings.Join(quoted, ", "))
+}
+
+func WithApplicationName(ctx context.Context, name string) context.Context {
+	return withSetting(ctx, "application_name", name)
+}
+
+// WithoutSettings hides the settings in ctx from the pool hooks.
+func WithoutSettings(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxKeySettings{}, []Setting(nil))
+}
+
+func SettingsFrom(ctx context.Context) []Setting {
+	settings, _ := ctx.Value(ctxKeySettings{}).([]Setting)
+	return settings
+}
+
+type execer interface {
+	Exec(context.Context, string, ...any) (pgconn.CommandTag, error)
+}
+
+// ApplySettings sets all settings in one round-trip. With local set they last
+// until the end of the current transaction.
+func ApplySettings(ctx context.Context, db execer, settings []Setting, local bool) error {
+	if len(settings) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(settings))
+	values := make([]string, 0, len(settings))
+	for _, s := range settings {
+		names = append(names, s.Name)
+		values = append(values, s.Value)
+	}
+
+	_, err := db.Exec(ctx,
+		"SELECT set_config(s.name, s.value, $3) FROM unnest($1::text[], $2::text[]) AS s(name, value)",
+		names, values, local)
+	if err != nil {
+		return fmt.Errorf("apply session settings: %w", err)
+	}
+
+	return nil
+}
+
+// sessionSettings tracks the settings applied to pooled connections, so they
+// can be reset on release.
+type sessionSettings struct {
+	applied sync.Map // *pgx.Conn -> []Setting
+}
+
+// apply sets the settings in ctx on conn for the rest of its acquisition.
+func (s *sessionSettings) apply(ctx context.Context, conn execer) error {
+	settings := SettingsFrom(ctx)
+	if len(settings) == 0 {
+		return nil
+	}
+	if err := ApplySettings(ctx, conn, settings, false); err != nil {
+		return err
+	}
+	s.applied.Store(conn, settings)
+	return nil
+}
+
+// installSessionSettings applies context settings when a connection is
+// acquired and resets them when it is released. A connection that cannot be
+// reset is destroyed rather than returned to the pool.
+//
+// A pool hook cannot return an error. If the server rejects a setting, e.g.
+// an unknown parameter, the connection is handed out without it and the
+// error is only logged; the engine's Exec, Query and QueryRow report it
+// instead.
+func installSessionSettings(cfg *pgxpool.Config, s *sessionSettings) {
+	cfg.BeforeAcquire = func(ctx context.Context, conn *pgx.Conn) bool {
+		return s.acquire(ctx, conn)
+	}
+	cfg.AfterRelease = func(conn *pgx.Conn) bool {
+		return s.release(conn)
+	}
+	cfg.BeforeClose = func(conn *pgx.Conn) {
+		s.applied.Delete(conn)
+	}
+}
+
+// acquire applies the settings in ctx to conn and reports whether the pool
+// may hand it out.
+func (s *sessionSettings) acquire(ctx context.Context, conn execer) bool {
+	err := s.apply(ctx, conn)
+	if err == nil {
+		return true
+	}
+
+	// Another connection would fail the same way; discarding it would
+	// make Acquire loop until ctx is done.
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		slog.ErrorContext(ctx, "session settings not applied", "error", err)
+		return true
+	}
+	slog.WarnContext(ctx, "discarding connection", "error", err)
+	return false
+}
+
+// release resets the settings applied to conn and reports whether it can go
+// back to the pool.
+func (s *sessionSettings) release(conn execer) bool {
+	v, ok := s.applied.LoadAndDelete(conn)
+	if !ok {
+		return true
+	}
+
+	var sb strings.Builder
+	for _, setting := range v.([]Setting) {
+		// Names were validated by WithSetting.
+		sb.WriteString("RESET " + setting.Name + ";")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := conn.Exec(ctx, sb.String())
+	return err == nil
+}
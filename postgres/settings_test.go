@@ -0,0 +1,149 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// recordingConn records the statements run on it and fails them with err.
+type recordingConn struct {
+	sql  []string
+	args [][]any
+	err  error
+}
+
+func (c *recordingConn) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	c.sql = append(c.sql, sql)
+	c.args = append(c.args, args)
+	return pgconn.CommandTag{}, c.err
+}
+
+func TestWithSetting(t *testing.T) {
+	ctx, err := WithSetting(context.Background(), "app.tenant_id", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = WithApplicationName(ctx, "api")
+	if ctx, err = WithSetting(ctx, "app.tenant_id", "2"); err != nil {
+		t.Fatal(err)
+	}
+	want := []Setting{{"application_name", "api"}, {"app.tenant_id", "2"}}
+	if got := SettingsFrom(ctx); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings = %v, want %v", got, want)
+	}
+
+	for _, name := range []string{"", "1abc", "a.b.c", "search_path; DROP TABLE t", "a-b"} {
+		got, err := WithSetting(ctx, name, "x")
+		if err == nil {
+			t.Errorf("WithSetting(%q) accepted the name", name)
+		}
+		if got != ctx {
+			t.Errorf("WithSetting(%q) changed the context", name)
+		}
+	}
+}
+
+func TestWithStatementTimeout(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0"},
+		{time.Microsecond, "1"},
+		{time.Millisecond, "1"},
+		{1500 * time.Microsecond, "2"},
+		{2 * time.Second, "2000"},
+	}
+	for _, tt := range tests {
+		got := SettingsFrom(WithStatementTimeout(context.Background(), tt.d))
+		if len(got) != 1 || got[0] != (Setting{"statement_timeout", tt.want}) {
+			t.Errorf("WithStatementTimeout(%s) = %v, want %s", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestWithSearchPathQuotes(t *testing.T) {
+	got := SettingsFrom(WithSearchPath(context.Background(), "tenant_1", `we"ird`))
+	if want := `"tenant_1", "we""ird"`; len(got) != 1 || got[0].Value != want {
+		t.Errorf("search_path = %v, want %s", got, want)
+	}
+}
+
+func TestApplySettings(t *testing.T) {
+	conn := &recordingConn{}
+	if err := ApplySettings(context.Background(), conn, nil, true); err != nil || len(conn.sql) != 0 {
+		t.Fatalf("no settings: err = %v, ran %v", err, conn.sql)
+	}
+
+	settings := []Setting{{"app.tenant_id", "1"}, {"statement_timeout", "500"}}
+	if err := ApplySettings(context.Background(), conn, settings, true); err != nil {
+		t.Fatal(err)
+	}
+	wantArgs := []any{[]string{"app.tenant_id", "statement_timeout"}, []string{"1", "500"}, true}
+	if len(conn.sql) != 1 || !reflect.DeepEqual(conn.args[0], wantArgs) {
+		t.Errorf("ran %v with %v, want one set_config with %v", conn.sql, conn.args, wantArgs)
+	}
+
+	conn.err = errors.New("boom")
+	if err := ApplySettings(context.Background(), conn, settings, false); !errors.Is(err, conn.err) {
+		t.Errorf("err = %v, want it to wrap %v", err, conn.err)
+	}
+}
+
+func TestSessionSettingsResetOnRelease(t *testing.T) {
+	var s sessionSettings
+	conn := &recordingConn{}
+
+	// Nothing applied, nothing to reset.
+	if !s.acquire(context.Background(), conn) || !s.release(conn) || len(conn.sql) != 0 {
+		t.Fatalf("ran %v without settings", conn.sql)
+	}
+
+	ctx := WithStatementTimeout(WithApplicationName(context.Background(), "api"), time.Second)
+	if !s.acquire(ctx, conn) {
+		t.Fatal("connection discarded")
+	}
+	if !s.release(conn) {
+		t.Fatal("connection not returned to the pool")
+	}
+	if want := "RESET application_name;RESET statement_timeout;"; len(conn.sql) != 2 || conn.sql[1] != want {
+		t.Errorf("ran %q, want the reset %q", conn.sql, want)
+	}
+
+	// A second release has nothing left to reset.
+	if !s.release(conn) || len(conn.sql) != 2 {
+		t.Errorf("ran %q after the reset", conn.sql)
+	}
+}
+
+func TestSessionSettingsFailures(t *testing.T) {
+	ctx := WithApplicationName(context.Background(), "api")
+
+	var s sessionSettings
+	rejected := &recordingConn{err: &pgconn.PgError{Code: "42704", Message: "unrecognized configuration parameter"}}
+	if !s.acquire(ctx, rejected) {
+		t.Error("a setting the server rejects discarded the connection")
+	}
+	if !s.release(rejected) || len(rejected.sql) != 1 {
+		t.Errorf("ran %q, want no reset of settings never applied", rejected.sql)
+	}
+
+	broken := &recordingConn{err: errors.New("connection reset")}
+	if s.acquire(ctx, broken) {
+		t.Error("a broken connection was handed out")
+	}
+
+	conn := &recordingConn{}
+	if !s.acquire(ctx, conn) {
+		t.Fatal("connection discarded")
+	}
+	conn.err = errors.New("connection reset")
+	if s.release(conn) {
+		t.Error("a connection that failed its reset went back to the pool")
+	}
+}
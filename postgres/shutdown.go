@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ===============================
+// In-flight connection tracking
+// ===============================
+
+type holder struct {
+	// closeSocket closes the network connection under the pgx.Conn.
+	closeSocket func() error
+	since       time.Time
+	caller      string
+	stack       string
+}
+
+// connTracker remembers who acquired each busy connection, so a stuck
+// shutdown can name the code that never released it.
+type connTracker struct {
+	stacks bool
+
+	mu   sync.Mutex
+	held map[*pgx.Conn]holder
+}
+
+func installConnTracker(cfg *pgxpool.Config, t *connTracker) {
+	t.held = make(map[*pgx.Conn]holder)
+
+	prevAcquire := cfg.BeforeAcquire
+	cfg.BeforeAcquire = func(ctx context.Context, conn *pgx.Conn) bool {
+		if prevAcquire != nil && !prevAcquire(ctx, conn) {
+			return false
+		}
+		t.acquired(conn)
+		return true
+	}
+
+	prevRelease := cfg.AfterRelease
+	cfg.AfterRelease = func(conn *pgx.Conn) bool {
+		t.released(conn)
+		if prevRelease != nil {
+			return prevRelease(conn)
+		}
+		return true
+	}
+
+	// Connections destroyed on release skip AfterRelease.
+	prevClose := cfg.BeforeClose
+	cfg.BeforeClose = func(conn *pgx.Conn) {
+		t.released(conn)
+		if prevClose != nil {
+			prevClose(conn)
+		}
+	}
+}
+
+func (t *connTracker) acquired(conn *pgx.Conn) {
+	h := holder{closeSocket: conn.PgConn().Conn().Close, since: time.Now()}
+
+	var pcs [32]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	var sb strings.Builder
+	for {
+		f, more := frames.Next()
+		if h.caller == "" && !isInternalFrame(f.Function) {
+			h.caller = fmt.Sprintf("%s (%s:%d)", f.Function, f.File, f.Line)
+			if !t.stacks {
+				break
+			}
+		}
+		if t.stacks {
+			fmt.Fprintf(&sb, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	h.stack = sb.String()
+
+	t.mu.Lock()
+	t.held[conn] = h
+	t.mu.Unlock()
+}
+
+func (t *connTracker) released(conn *pgx.Conn) {
+	t.mu.Lock()
+	delete(t.held, conn)
+	t.mu.Unlock()
+}
+
+func (t *connTracker) holders() []holder {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]holder, 0, len(t.held))
+	for _, h := range t.held {
+		out = append(out, h)
+	}
+	return out
+}
+
+func isInternalFrame(fn string) bool {
+	for _, prefix := range []string{
+		"runtime.",
+		"github.com/jackc/",
+		"github.com/nghiatrann0502/kyra-kit/postgres.",
+		"github.com/nghiatrann0502/kyra-kit/tx.",
+	} {
+		if strings.HasPrefix(fn, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ===============================
+// Shutdown
+// ===============================
+
+// Shutdown closes the pool to new acquires and waits for connections in use
+// to be released until ctx is done. It then logs every holder, closes their
+// network connections and returns an error. Closing the socket fails what a
+// holder is waiting on, so code that releases its connection on error lets
+// the pool finish closing in the background. Code that never releases, e.g.
+// a leaked pgx.Rows, keeps the pool open; Shutdown can be called again to
+// wait longer, and reports the holders again if they are still there.
+func (p *postgres) Shutdown(ctx context.Context) error {
+	p.shuttingDown.Store(true)
+	if p.stop != nil {
+		p.stop()
+	}
+	if p.closePool == nil {
+		return nil
+	}
+
+	p.closeOnce.Do(func() {
+		p.closed = make(chan struct{})
+		go func() {
+			p.closePool()
+			close(p.closed)
+		}()
+	})
+
+	select {
+	case <-p.closed:
+		return nil
+	case <-ctx.Done():
+	}
+
+	holders := p.tracker.holders()
+	for _, h := range holders {
+		attrs := []any{"held_for", time.Since(h.since).Round(time.Millisecond), "caller", h.caller}
+		if h.stack != "" {
+			attrs = append(attrs, "stack", h.stack)
+		}
+		slog.Error("postgres connection still in use at shutdown", attrs...)
+
+		// Closing the socket is safe while another goroutine uses the
+		// connection; its pending and later operations fail. The pool
+		// only finishes closing once the holder releases the connection.
+		_ = h.closeSocket()
+	}
+
+	return fmt.Errorf("postgres: shutdown: %d connection(s) still in use: %w", len(holders), ctx.Err())
+}
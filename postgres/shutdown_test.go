@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// fakePool stands in for the pool: it closes once release is called for
+// every held connection.
+type fakePool struct {
+	p       *postgres
+	release chan *pgx.Conn
+	closes  atomic.Int32
+}
+
+func newFakePool() *fakePool {
+	f := &fakePool{p: &postgres{}, release: make(chan *pgx.Conn)}
+	f.p.tracker.held = make(map[*pgx.Conn]holder)
+	f.p.closePool = func() {
+		f.closes.Add(1)
+		for len(f.p.tracker.holders()) > 0 {
+			f.p.tracker.released(<-f.release)
+		}
+	}
+	return f
+}
+
+// hold registers a busy connection and returns it with a counter of the
+// times its socket was closed.
+func (f *fakePool) hold(caller string) (*pgx.Conn, *atomic.Int32) {
+	conn, closed := new(pgx.Conn), new(atomic.Int32)
+	f.p.tracker.mu.Lock()
+	f.p.tracker.held[conn] = holder{
+		closeSocket: func() error { closed.Add(1); return nil },
+		since:       time.Now(),
+		caller:      caller,
+	}
+	f.p.tracker.mu.Unlock()
+	return conn, closed
+}
+
+func shutdownWithin(p *postgres, d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return p.Shutdown(ctx)
+}
+
+func TestShutdownWaitsForRelease(t *testing.T) {
+	f := newFakePool()
+	conn, closed := f.hold("worker")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.release <- conn
+	}()
+
+	if err := shutdownWithin(f.p, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if closed.Load() != 0 {
+		t.Error("socket of a released connection was closed")
+	}
+	if !f.p.shuttingDown.Load() {
+		t.Error("pool not marked as shutting down")
+	}
+}
+
+func TestShutdownDeadlineClosesHolders(t *testing.T) {
+	f := newFakePool()
+	_, closed := f.hold("leaky")
+
+	err := shutdownWithin(f.p, 10*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "1 connection(s) still in use") {
+		t.Fatalf("err = %v, want the count of held connections", err)
+	}
+	if closed.Load() != 1 {
+		t.Errorf("socket closed %d times, want 1", closed.Load())
+	}
+}
+
+func TestShutdownAgainWhileHeld(t *testing.T) {
+	f := newFakePool()
+	conn, closed := f.hold("leaky")
+
+	if err := shutdownWithin(f.p, 10*time.Millisecond); err == nil {
+		t.Fatal("first Shutdown returned nil with a connection held")
+	}
+	// A second call must not report success while the pool is still open.
+	if err := shutdownWithin(f.p, 10*time.Millisecond); err == nil {
+		t.Fatal("second Shutdown returned nil with a connection held")
+	}
+	if closed.Load() != 2 {
+		t.Errorf("socket closed %d times, want once per Shutdown", closed.Load())
+	}
+
+	f.release <- conn
+	if err := shutdownWithin(f.p, time.Second); err != nil {
+		t.Fatalf("Shutdown after release = %v", err)
+	}
+	if n := f.closes.Load(); n != 1 {
+		t.Errorf("pool closed %d times, want 1", n)
+	}
+}
+
+func TestShutdownWithoutPool(t *testing.T) {
+	if err := shutdownWithin(&postgres{}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
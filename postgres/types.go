@@ -0,0 +1,203 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ===============================
+// Custom type registration
+// ===============================
+
+// typeRegistry registers custom types on every new connection. The type
+// definitions are loaded from the server once and reused afterwards, so only
+// the first connection pays for the round-trip. Every connection gets its own
+// codecs: pgx codecs such as EnumCodec cache state without locking and must
+// not be shared between connections.
+type typeRegistry struct {
+	names []string
+	hooks []func(*pgtype.Map)
+
+	mu    sync.Mutex
+	specs []typeSpec
+}
+
+// typeSpec is what a connection needs to rebuild a loaded type.
+type typeSpec struct {
+	name string
+	oid  uint32
+	// kind is the pg_type.typtype of the type, or 0 for a domain over a
+	// built-in type, which keeps the base type's codec.
+	kind byte
+	// elem is the element type of an array, range or multirange, or the base
+	// type of a domain over another loaded type.
+	elem   uint32
+	fields []fieldSpec
+	codec  pgtype.Codec
+}
+
+type fieldSpec struct {
+	name string
+	oid  uint32
+}
+
+func (r *typeRegistry) empty() bool {
+	return len(r.names) == 0 && len(r.hooks) == 0
+}
+
+func (r *typeRegistry) register(ctx context.Context, conn *pgx.Conn) error {
+	m := conn.TypeMap()
+	// Codecs first: loaded composite types may have fields that use them.
+	for _, hook := range r.hooks {
+		hook(m)
+	}
+	if len(r.names) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.specs == nil {
+		// LoadTypes registers the types on this connection itself.
+		types, err := conn.LoadTypes(ctx, r.names)
+		if err != nil {
+			return fmt.Errorf("load types %v: %w", r.names, err)
+		}
+		r.specs = specsOf(types)
+		return nil
+	}
+
+	return registerSpecs(m, r.specs)
+}
+
+func specsOf(types []*pgtype.Type) []typeSpec {
+	specs := make([]typeSpec, 0, len(types))
+	for i, t := range types {
+		spec := typeSpec{name: t.Name, oid: t.OID}
+		// A domain shares its base type's codec.
+		if base, ok := loadedBase(types[:i], t); ok {
+			spec.kind, spec.elem = 'd', base
+			specs = append(specs, spec)
+			continue
+		}
+
+		switch c := t.Codec.(type) {
+		case *pgtype.EnumCodec:
+			spec.kind = 'e'
+		case *pgtype.ArrayCodec:
+			spec.kind, spec.elem = 'b', c.ElementType.OID
+		case *pgtype.CompositeCodec:
+			spec.kind = 'c'
+			for _, f := range c.Fields {
+				spec.fields = append(spec.fields, fieldSpec{name: f.Name, oid: f.Type.OID})
+			}
+		case *pgtype.RangeCodec:
+			spec.kind, spec.elem = 'r', c.ElementType.OID
+		case *pgtype.MultirangeCodec:
+			spec.kind, spec.elem = 'm', c.ElementType.OID
+		default:
+			// A domain over a built-in type; those codecs are stateless.
+			spec.codec = t.Codec
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// loadedBase returns the OID of the type in loaded whose codec t shares.
+func loadedBase(loaded []*pgtype.Type, t *pgtype.Type) (uint32, bool) {
+	for _, base := range loaded {
+		if base.OID != t.OID && sameCodec(base.Codec, t.Codec) {
+			return base.OID, true
+		}
+	}
+	return 0, false
+}
+
+// sameCodec compares codec pointers; codecs held by value may not be
+// comparable.
+func sameCodec(a, b pgtype.Codec) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	return va.Kind() == reflect.Pointer && vb.Kind() == reflect.Pointer &&
+		va.Type() == vb.Type() && va.Pointer() == vb.Pointer()
+}
+
+// registerSpecs registers fresh codecs for specs on m, in load order so that
+// every type finds the ones it depends on.
+func registerSpecs(m *pgtype.Map, specs []typeSpec) error {
+	// The same type may be listed under its plain and qualified names; both
+	// get the same codec.
+	built := make(map[uint32]pgtype.Codec, len(specs))
+	lookup := func(spec typeSpec, oid uint32) (*pgtype.Type, error) {
+		t, ok := m.TypeForOID(oid)
+		if !ok {
+			return nil, fmt.Errorf("type %q depends on OID %d, which is not registered", spec.name, oid)
+		}
+		return t, nil
+	}
+
+	for _, spec := range specs {
+		codec, ok := built[spec.oid]
+		if !ok {
+			switch spec.kind {
+			case 'e':
+				codec = &pgtype.EnumCodec{}
+			case 'b', 'r', 'm', 'd':
+				elem, err := lookup(spec, spec.elem)
+				if err != nil {
+					return err
+				}
+				switch spec.kind {
+				case 'b':
+					codec = &pgtype.ArrayCodec{ElementType: elem}
+				case 'r':
+					codec = &pgtype.RangeCodec{ElementType: elem}
+				case 'm':
+					codec = &pgtype.MultirangeCodec{ElementType: elem}
+				default:
+					codec = elem.Codec
+				}
+			case 'c':
+				fields := make([]pgtype.CompositeCodecField, 0, len(spec.fields))
+				for _, f := range spec.fields {
+					t, err := lookup(spec, f.oid)
+					if err != nil {
+						return err
+					}
+					fields = append(fields, pgtype.CompositeCodecField{Name: f.name, Type: t})
+				}
+				codec = &pgtype.CompositeCodec{Fields: fields}
+			default:
+				codec = spec.codec
+			}
+			built[spec.oid] = codec
+		}
+
+		m.RegisterType(&pgtype.Type{Name: spec.name, OID: spec.oid, Codec: codec})
+	}
+
+	return nil
+}
+
+func installTypeRegistry(cfg *pgxpool.Config, r *typeRegistry) {
+	if r.empty() {
+		return
+	}
+
+	prev := cfg.AfterConnect
+	cfg.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		if prev != nil {
+			if err := prev(ctx, conn); err != nil {
+				return err
+			}
+		}
+		return r.register(ctx, conn)
+	}
+}
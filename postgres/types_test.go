@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestRegisterSpecsBuildsCodecsPerConnection(t *testing.T) {
+	// What LoadTypes returns for: enum mood, mood[], composite with a mood
+	// field, a domain over mood and a domain over text.
+	first := pgtype.NewMap()
+	text, _ := first.TypeForOID(pgtype.TextOID)
+	mood := &pgtype.Type{Name: "mood", OID: 100001, Codec: &pgtype.EnumCodec{}}
+	loaded := []*pgtype.Type{
+		{Name: "public.mood", OID: mood.OID, Codec: mood.Codec},
+		mood,
+		{Name: "_mood", OID: 100002, Codec: &pgtype.ArrayCodec{ElementType: mood}},
+		{Name: "person", OID: 100003, Codec: &pgtype.CompositeCodec{Fields: []pgtype.CompositeCodecField{
+			{Name: "name", Type: text},
+			{Name: "mood", Type: mood},
+		}}},
+		{Name: "feeling", OID: 100004, Codec: mood.Codec},
+		{Name: "label", OID: 100005, Codec: text.Codec},
+	}
+
+	specs := specsOf(loaded)
+	m1, m2 := pgtype.NewMap(), pgtype.NewMap()
+	for _, m := range []*pgtype.Map{m1, m2} {
+		if err := registerSpecs(m, specs); err != nil {
+			t.Fatalf("registerSpecs: %v", err)
+		}
+	}
+
+	codec := func(m *pgtype.Map, name string) pgtype.Codec {
+		t.Helper()
+		typ, ok := m.TypeForName(name)
+		if !ok {
+			t.Fatalf("type %q not registered", name)
+		}
+		return typ.Codec
+	}
+
+	enum1, ok := codec(m1, "mood").(*pgtype.EnumCodec)
+	if !ok {
+		t.Fatalf("mood codec is %T, want *pgtype.EnumCodec", codec(m1, "mood"))
+	}
+	if enum1 == mood.Codec || enum1 == codec(m2, "mood") {
+		t.Error("enum codec shared between connections")
+	}
+	if codec(m1, "public.mood") != enum1 {
+		t.Error("qualified name has a different codec than the plain one")
+	}
+	if codec(m1, "feeling") != enum1 {
+		t.Error("domain over enum does not use the connection's enum codec")
+	}
+	if codec(m1, "label") != text.Codec {
+		t.Error("domain over text does not keep the text codec")
+	}
+
+	arr := codec(m1, "_mood").(*pgtype.ArrayCodec)
+	if arr.ElementType.Codec != enum1 {
+		t.Error("array element does not use the connection's enum codec")
+	}
+	comp := codec(m1, "person").(*pgtype.CompositeCodec)
+	if comp.Fields[1].Type.Codec != enum1 {
+		t.Error("composite field does not use the connection's enum codec")
+	}
+}
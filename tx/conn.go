@@ -0,0 +1,76 @@
+package tx
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nghiatrann0502/kyra-kit/postgres"
+)
+
+// ===== Dedicated connection =====
+
+type ctxKeyConn struct{}
+
+type connScope struct {
+	db   postgres.DBEngine
+	conn postgres.Conn
+}
+
+// resetSession undoes the session state WithConn is meant for before the
+// connection goes back to the pool.
+const resetSession = "SELECT pg_advisory_unlock_all(); UNLISTEN *; DISCARD TEMP"
+
+// WithConn runs fn with one connection of db held for its whole duration,
+// for temporary tables, session advisory locks or LISTEN. FromCtxOr returns
+// the connection, and WithinTx on a unit of work over db begins its
+// transaction on it. Session advisory locks, LISTENs and temporary tables
+// are dropped before the connection is released.
+//
+// Inside a transaction, or another WithConn on db, fn runs on the connection
+// already in use.
+func WithConn(ctx context.Context, db postgres.DBEngine, fn func(ctx context.Context) error) error {
+	if stateFrom(ctx) != nil {
+		return fn(ctx)
+	}
+	if s := connScopeFrom(ctx); s != nil && s.db == db {
+		return fn(ctx)
+	}
+
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if _, err := conn.Exec(context.WithoutCancel(ctx), resetSession); err != nil {
+			// Leave nothing behind for the next user.
+			_ = conn.Destroy(context.WithoutCancel(ctx))
+			return
+		}
+		conn.Release()
+	}()
+
+	return fn(context.WithValue(ctx, ctxKeyConn{}, &connScope{db: db, conn: conn}))
+}
+
+func connScopeFrom(ctx context.Context) *connScope {
+	s, _ := ctx.Value(ctxKeyConn{}).(*connScope)
+	return s
+}
+
+// ConnFrom returns the connection held by WithConn, or nil.
+func ConnFrom(ctx context.Context) postgres.Conn {
+	if s := connScopeFrom(ctx); s != nil {
+		return s.conn
+	}
+	return nil
+}
+
+// beginTx begins on the connection held by WithConn if it belongs to db and
+// is not already in a transaction, as with RequiresNew.
+func beginTx(ctx context.Context, db postgres.DBEngine, opts pgx.TxOptions) (pgx.Tx, error) {
+	if s := connScopeFrom(ctx); s != nil && s.db == db && stateFrom(ctx) == nil {
+		return s.conn.BeginTx(ctx, opts)
+	}
+	return db.BeginTx(ctx, opts)
+}
@@ -0,0 +1,117 @@
+package tx_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nghiatrann0502/kyra-kit/errors"
+	"github.com/nghiatrann0502/kyra-kit/postgres/pgtest"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+const resetSession = "SELECT pg_advisory_unlock_all(); UNLISTEN *; DISCARD TEMP"
+
+// pinnedOnly fails the test if a transaction is begun on the pool rather
+// than on the connection held by WithConn.
+type pinnedOnly struct {
+	*pgtest.Mock
+	t *testing.T
+}
+
+func (p pinnedOnly) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	p.t.Error("transaction begun on the pool")
+	return p.Mock.BeginTx(ctx, opts)
+}
+
+func TestWithConnPinsTransactions(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectAcquire()
+	m.ExpectExec("CREATE TEMP TABLE scratch (id int)")
+	m.ExpectBegin()
+	m.ExpectExec("INSERT INTO scratch VALUES (1)")
+	m.ExpectCommit()
+	m.ExpectExec(resetSession)
+	m.ExpectRelease()
+
+	db := pinnedOnly{Mock: m, t: t}
+	u := tx.NewUnitOfWord(db)
+	err := tx.WithConn(context.Background(), db, func(ctx context.Context) error {
+		conn := tx.ConnFrom(ctx)
+		if conn == nil || tx.FromCtxOr(ctx, db) != conn {
+			t.Fatal("the held connection is not in ctx")
+		}
+		if _, err := conn.Exec(ctx, "CREATE TEMP TABLE scratch (id int)"); err != nil {
+			return err
+		}
+		// A nested WithConn reuses the held connection.
+		return tx.WithConn(ctx, db, func(ctx context.Context) error {
+			return tx.WithinTx(ctx, u, func(ctx context.Context) error {
+				_, err := tx.TxFrom(ctx).Exec(ctx, "INSERT INTO scratch VALUES (1)")
+				return err
+			})
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithConnInsideTx(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectCommit()
+
+	err := tx.WithinTx(context.Background(), tx.NewUnitOfWord(m), func(ctx context.Context) error {
+		outer := tx.TxFrom(ctx)
+		return tx.WithConn(ctx, m, func(ctx context.Context) error {
+			if tx.TxFrom(ctx) != outer || tx.ConnFrom(ctx) != nil {
+				t.Error("WithConn inside a transaction did not stay on it")
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithConnResetsSession(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectAcquire()
+	m.ExpectExec(resetSession)
+	m.ExpectRelease()
+
+	// The session is reset even when fn fails.
+	err := tx.WithConn(context.Background(), m, func(context.Context) error {
+		return fnErr
+	})
+	if err != error(fnErr) {
+		t.Errorf("err = %v, want %v", err, fnErr)
+	}
+}
+
+func TestWithConnDestroysOnFailedReset(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectAcquire()
+	m.ExpectExec(resetSession).WillReturnError(rbErr)
+	m.ExpectDestroy()
+
+	if err := tx.WithConn(context.Background(), m, func(context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithConnAcquireError(t *testing.T) {
+	m := pgtest.New(t)
+	acquireErr := errors.New(errors.ErrCodeDatabase, "pool closed")
+	m.ExpectAcquire().WillReturnError(acquireErr)
+
+	err := tx.WithConn(context.Background(), m, func(context.Context) error {
+		t.Error("fn ran")
+		return nil
+	})
+	if !errors.Is(err, acquireErr) {
+		t.Errorf("err = %v, want %v", err, acquireErr)
+	}
+}
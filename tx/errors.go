@@ -0,0 +1,31 @@
+package tx
+
+import (
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nghiatrann0502/kyra-kit/errors"
+)
+
+// ===== Error enrichment =====
+
+// withRollbackError joins a failed rollback to err, the error that caused it.
+func withRollbackError(err, rbErr error) error {
+	if rbErr == nil || errors.Is(rbErr, pgx.ErrTxClosed) {
+		return err
+	}
+	return errors.Wrap(errors.Join(err, rbErr), errors.ErrCodeDatabase, "rollback transaction")
+}
+
+func commitError(err error) error {
+	return errors.Wrap(errors.Join(ErrCommitFailed, err), errors.ErrCodeDatabase, "commit transaction")
+}
+
+// panicError runs in the deferred rollback, before the stack unwinds, so the
+// captured stack still leads to the panic.
+func panicError(r any) error {
+	if err, ok := r.(error); ok {
+		return errors.Wrap(err, errors.ErrCodeInternal, "tx: panic")
+	}
+	return errors.New(errors.ErrCodeInternal, fmt.Sprintf("tx: panic: %v", r))
+}
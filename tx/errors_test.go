@@ -0,0 +1,125 @@
+package tx_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nghiatrann0502/kyra-kit/errors"
+	"github.com/nghiatrann0502/kyra-kit/postgres/pgtest"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+var (
+	fnErr = &pgconn.PgError{Code: "23505", Message: "duplicate key"}
+	rbErr = &pgconn.PgError{Code: "08006", Message: "connection failure"}
+)
+
+func TestRollbackErrorIsJoined(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectRollback().WillReturnError(rbErr)
+
+	err := tx.WithinTx(context.Background(), tx.NewUnitOfWord(m), func(context.Context) error {
+		return fnErr
+	})
+	if !errors.Is(err, fnErr) || !errors.Is(err, rbErr) {
+		t.Fatalf("err = %v, want both the fn and the rollback error", err)
+	}
+	if code := errors.GetCode(err); code != errors.ErrCodeDatabase {
+		t.Errorf("code = %d, want %d", code, errors.ErrCodeDatabase)
+	}
+}
+
+func TestSavepointRollbackErrorIsJoined(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectBegin()
+	m.ExpectRollback().WillReturnError(rbErr)
+	m.ExpectRollback()
+
+	u := tx.NewUnitOfWord(m)
+	err := tx.WithinTx(context.Background(), u, func(ctx context.Context) error {
+		return tx.WithinTxOpts(ctx, u, func(context.Context) error {
+			return fnErr
+		}, tx.WithPropagation(tx.Nested))
+	})
+	if !errors.Is(err, fnErr) || !errors.Is(err, rbErr) {
+		t.Fatalf("err = %v, want both the fn and the rollback error", err)
+	}
+}
+
+func TestClosedTxRollbackIsIgnored(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectRollback().WillReturnError(pgx.ErrTxClosed)
+
+	err := tx.WithinTx(context.Background(), tx.NewUnitOfWord(m), func(context.Context) error {
+		return fnErr
+	})
+	if err != error(fnErr) {
+		t.Errorf("err = %v, want the fn error unchanged", err)
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		check func(t *testing.T, err error)
+	}{
+		{"value", "boom", func(t *testing.T, err error) {
+			if !strings.Contains(err.Error(), "tx: panic: boom") {
+				t.Errorf("err = %v, want the panic value", err)
+			}
+		}},
+		{"error", fnErr, func(t *testing.T, err error) {
+			if !errors.Is(err, fnErr) {
+				t.Errorf("err = %v, want it to wrap the panic error", err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := pgtest.New(t)
+			m.ExpectBegin()
+			m.ExpectRollback()
+
+			rolledBack := false
+			err := tx.WithinTxOpts(context.Background(), tx.NewUnitOfWord(m), func(ctx context.Context) error {
+				_ = tx.OnRollback(ctx, func(context.Context) { rolledBack = true })
+				panic(tt.value)
+			}, tx.RecoverPanics())
+			if code := errors.GetCode(err); code != errors.ErrCodeInternal {
+				t.Errorf("code = %d, want %d", code, errors.ErrCodeInternal)
+			}
+			tt.check(t, err)
+			if !rolledBack {
+				t.Error("rollback hooks did not run")
+			}
+		})
+	}
+}
+
+func TestPanicPropagatesAfterRollback(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectRollback()
+
+	rolledBack := false
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("recovered %v, want the original panic", r)
+		}
+		if !rolledBack {
+			t.Error("the transaction was not rolled back before the panic propagated")
+		}
+	}()
+	_ = tx.WithinTx(context.Background(), tx.NewUnitOfWord(m), func(ctx context.Context) error {
+		_ = tx.OnRollback(ctx, func(context.Context) { rolledBack = true })
+		panic("boom")
+	})
+	t.Error("WithinTx returned instead of panicking")
+}
@@ -0,0 +1,137 @@
+package tx
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nghiatrann0502/kyra-kit/errors"
+)
+
+// ===== Use-after-finish guard =====
+
+// guardedTx is the pgx.Tx handed to fn. Once the transaction is committed or
+// rolled back it refuses every statement with an error naming where the
+// transaction was opened, instead of pgx's bare "tx is closed".
+type guardedTx struct {
+	pgx.Tx
+	openedAt string
+	finished atomic.Bool
+	// statements is shared with the savepoints of the transaction.
+	statements *atomic.Int64
+}
+
+func newGuardedTx(tx pgx.Tx, statements *atomic.Int64) *guardedTx {
+	return &guardedTx{Tx: tx, openedAt: callerOutsidePackage(), statements: statements}
+}
+
+func (g *guardedTx) finish() {
+	g.finished.Store(true)
+}
+
+// check is called before every statement, so it also counts them.
+func (g *guardedTx) check(n int) error {
+	if !g.finished.Load() {
+		g.statements.Add(int64(n))
+		return nil
+	}
+	return errors.Wrap(ErrTxFinished, errors.ErrCodeInternal,
+		fmt.Sprintf("transaction opened at %s used after it finished", g.openedAt))
+}
+
+func (g *guardedTx) Begin(ctx context.Context) (pgx.Tx, error) {
+	if err := g.check(0); err != nil {
+		return nil, err
+	}
+	return g.Tx.Begin(ctx)
+}
+
+func (g *guardedTx) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	if err := g.check(1); err != nil {
+		return 0, err
+	}
+	return g.Tx.CopyFrom(ctx, tableName, columnNames, rowSrc)
+}
+
+func (g *guardedTx) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	if err := g.check(b.Len()); err != nil {
+		return errBatchResults{err: err}
+	}
+	return g.Tx.SendBatch(ctx, b)
+}
+
+func (g *guardedTx) Prepare(ctx context.Context, name, sql string) (*pgconn.StatementDescription, error) {
+	if err := g.check(1); err != nil {
+		return nil, err
+	}
+	return g.Tx.Prepare(ctx, name, sql)
+}
+
+func (g *guardedTx) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	if err := g.check(1); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return g.Tx.Exec(ctx, sql, arguments...)
+}
+
+func (g *guardedTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if err := g.check(1); err != nil {
+		return nil, err
+	}
+	return g.Tx.Query(ctx, sql, args...)
+}
+
+func (g *guardedTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if err := g.check(1); err != nil {
+		return errRow{err: err}
+	}
+	return g.Tx.QueryRow(ctx, sql, args...)
+}
+
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(...any) error {
+	return r.err
+}
+
+type errBatchResults struct {
+	err error
+}
+
+func (b errBatchResults) Exec() (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, b.err
+}
+
+func (b errBatchResults) Query() (pgx.Rows, error) {
+	return nil, b.err
+}
+
+func (b errBatchResults) QueryRow() pgx.Row {
+	return errRow{err: b.err}
+}
+
+func (b errBatchResults) Close() error {
+	return b.err
+}
+
+// callerOutsidePackage returns the first frame on the stack outside tx.
+func callerOutsidePackage() string {
+	var pcs [16]uintptr
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "github.com/nghiatrann0502/kyra-kit/tx.") {
+			return fmt.Sprintf("%s (%s:%d)", f.Function, f.File, f.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package tx_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nghiatrann0502/kyra-kit/errors"
+	"github.com/nghiatrann0502/kyra-kit/postgres/pgtest"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+func TestUseAfterFinish(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		fail bool
+	}{
+		{"commit", false},
+		{"rollback", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := pgtest.New(t)
+			m.ExpectBegin()
+			if tt.fail {
+				m.ExpectRollback()
+			} else {
+				m.ExpectCommit()
+			}
+
+			var leaked pgx.Tx
+			_ = tx.WithinTx(context.Background(), tx.NewUnitOfWord(m), func(ctx context.Context) error {
+				leaked = tx.TxFrom(ctx)
+				if tt.fail {
+					return fnErr
+				}
+				return nil
+			})
+
+			ctx := context.Background()
+			_, execErr := leaked.Exec(ctx, update)
+			_, queryErr := leaked.Query(ctx, "SELECT 1")
+			rowErr := leaked.QueryRow(ctx, "SELECT 1").Scan()
+			_, beginErr := leaked.Begin(ctx)
+			batchErr := leaked.SendBatch(ctx, &pgx.Batch{}).Close()
+			for name, err := range map[string]error{
+				"Exec": execErr, "Query": queryErr, "QueryRow": rowErr, "Begin": beginErr, "SendBatch": batchErr,
+			} {
+				if !errors.Is(err, tx.ErrTxFinished) {
+					t.Errorf("%s: err = %v, want ErrTxFinished", name, err)
+					continue
+				}
+				if !strings.Contains(err.Error(), "TestUseAfterFinish") {
+					t.Errorf("%s: err = %v, want it to name where the transaction was opened", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectRollback()
+
+	var hookErr error
+	start := time.Now()
+	err := tx.WithinTxOpts(context.Background(), tx.NewUnitOfWord(m), func(ctx context.Context) error {
+		deadline, ok := ctx.Deadline()
+		if !ok || deadline.Before(start.Add(10*time.Millisecond)) || deadline.After(time.Now().Add(10*time.Millisecond)) {
+			t.Errorf("deadline = %v, %t; want within the timeout", deadline, ok)
+		}
+		_ = tx.OnRollback(ctx, func(ctx context.Context) { hookErr = ctx.Err() })
+		<-ctx.Done()
+		return ctx.Err()
+	}, tx.WithTimeout(10*time.Millisecond))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+	// The rollback and hooks run on the caller's context, not the expired one.
+	if hookErr != nil {
+		t.Errorf("hook context err = %v, want nil", hookErr)
+	}
+}
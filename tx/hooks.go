@@ -0,0 +1,152 @@
+package tx
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// ===== Commit hooks =====
+
+// NoTxHooks decides what OnCommit and OnRollback do outside a transaction.
+type NoTxHooks int
+
+const (
+	// RunHooksImmediately runs an OnCommit callback right away, as there is
+	// nothing to wait for, and drops an OnRollback callback. Default.
+	RunHooksImmediately NoTxHooks = iota
+	// FailHooksWithoutTx makes OnCommit and OnRollback return ErrNoTx.
+	FailHooksWithoutTx
+)
+
+// WithNoTxHooks sets what the OnCommit and OnRollback methods of a unit of
+// work do when ctx holds no transaction. The package-level OnCommit and
+// OnRollback always use RunHooksImmediately. It is meant as a default passed
+// to NewUnitOfWord or NewMemoryTransactor; per-call it has no effect.
+func WithNoTxHooks(p NoTxHooks) Option {
+	return func(c *config) {
+		c.noTxHooks = p
+	}
+}
+
+// hooks holds the callbacks of an outermost transaction. Nested calls and
+// savepoints share the one of the transaction they join.
+type hooks struct {
+	mu       sync.Mutex
+	commit   []func(ctx context.Context)
+	rollback []func(ctx context.Context)
+}
+
+// OnCommit registers fn to run after the transaction in ctx commits. Callbacks
+// run in registration order with the caller's context of the outermost
+// WithinTx. A callback registered under a savepoint that is rolled back is
+// dropped.
+func OnCommit(ctx context.Context, fn func(ctx context.Context)) error {
+	return onCommit(ctx, RunHooksImmediately, fn)
+}
+
+// OnCommit is the package-level OnCommit with the WithNoTxHooks policy of u.
+func (u *UnitOfWork) OnCommit(ctx context.Context, fn func(ctx context.Context)) error {
+	return onCommit(ctx, newConfig(u.opts, nil).noTxHooks, fn)
+}
+
+// OnCommit is the package-level OnCommit with the WithNoTxHooks policy of m.
+func (m *MemoryTransactor) OnCommit(ctx context.Context, fn func(ctx context.Context)) error {
+	return onCommit(ctx, newConfig(m.opts, nil).noTxHooks, fn)
+}
+
+func onCommit(ctx context.Context, noTxHooks NoTxHooks, fn func(ctx context.Context)) error {
+	s := stateFrom(ctx)
+	if s == nil {
+		if noTxHooks == FailHooksWithoutTx {
+			return noTx("OnCommit")
+		}
+		runHook(ctx, fn)
+		return nil
+	}
+
+	s.hooks.mu.Lock()
+	s.hooks.commit = append(s.hooks.commit, fn)
+	s.hooks.mu.Unlock()
+
+	return nil
+}
+
+// OnRollback registers fn to run after the transaction in ctx rolls back,
+// including when its commit fails. With WithRetry it runs once per failed
+// attempt.
+func OnRollback(ctx context.Context, fn func(ctx context.Context)) error {
+	return onRollback(ctx, RunHooksImmediately, fn)
+}
+
+// OnRollback is the package-level OnRollback with the WithNoTxHooks policy
+// of u.
+func (u *UnitOfWork) OnRollback(ctx context.Context, fn func(ctx context.Context)) error {
+	return onRollback(ctx, newConfig(u.opts, nil).noTxHooks, fn)
+}
+
+// OnRollback is the package-level OnRollback with the WithNoTxHooks policy
+// of m.
+func (m *MemoryTransactor) OnRollback(ctx context.Context, fn func(ctx context.Context)) error {
+	return onRollback(ctx, newConfig(m.opts, nil).noTxHooks, fn)
+}
+
+func onRollback(ctx context.Context, noTxHooks NoTxHooks, fn func(ctx context.Context)) error {
+	s := stateFrom(ctx)
+	if s == nil {
+		if noTxHooks == FailHooksWithoutTx {
+			return noTx("OnRollback")
+		}
+		return nil
+	}
+
+	s.hooks.mu.Lock()
+	s.hooks.rollback = append(s.hooks.rollback, fn)
+	s.hooks.mu.Unlock()
+
+	return nil
+}
+
+// mark returns the number of commit callbacks registered so far.
+func (h *hooks) mark() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.commit)
+}
+
+// discard drops the commit callbacks registered after mark.
+func (h *hooks) discard(mark int) {
+	h.mu.Lock()
+	h.commit = h.commit[:mark]
+	h.mu.Unlock()
+}
+
+func (h *hooks) runCommit(ctx context.Context) {
+	h.mu.Lock()
+	fns := h.commit
+	h.mu.Unlock()
+
+	for _, fn := range fns {
+		runHook(ctx, fn)
+	}
+}
+
+func (h *hooks) runRollback(ctx context.Context) {
+	h.mu.Lock()
+	fns := h.rollback
+	h.mu.Unlock()
+
+	for _, fn := range fns {
+		runHook(ctx, fn)
+	}
+}
+
+// runHook runs fn so that a panicking callback does not stop the others.
+func runHook(ctx context.Context, fn func(ctx context.Context)) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.ErrorContext(ctx, "tx: hook panicked", "panic", r)
+		}
+	}()
+	fn(ctx)
+}
@@ -0,0 +1,166 @@
+package tx_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/nghiatrann0502/kyra-kit/errors"
+	"github.com/nghiatrann0502/kyra-kit/postgres/pgtest"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+// record returns a hook that appends name to calls.
+func record(calls *[]string, name string) func(context.Context) {
+	return func(context.Context) { *calls = append(*calls, name) }
+}
+
+func TestHooksRunAfterCommitInOrder(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectCommit()
+
+	var calls []string
+	u := tx.NewUnitOfWord(m)
+	err := tx.WithinTx(context.Background(), u, func(ctx context.Context) error {
+		for _, name := range []string{"first", "second"} {
+			if err := tx.OnCommit(ctx, record(&calls, name)); err != nil {
+				return err
+			}
+		}
+		if err := tx.OnRollback(ctx, record(&calls, "rollback")); err != nil {
+			return err
+		}
+		// A joined call shares the hooks of the outer transaction.
+		if err := tx.WithinTx(ctx, u, func(ctx context.Context) error {
+			return tx.OnCommit(ctx, record(&calls, "joined"))
+		}); err != nil {
+			return err
+		}
+		if calls != nil {
+			t.Errorf("hooks ran before commit: %v", calls)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"first", "second", "joined"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestHooksOnRollback(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectRollback()
+
+	var calls []string
+	boom := errors.New(errors.ErrCodeInternal, "boom")
+	err := tx.WithinTx(context.Background(), tx.NewUnitOfWord(m), func(ctx context.Context) error {
+		_ = tx.OnCommit(ctx, record(&calls, "commit"))
+		_ = tx.OnRollback(ctx, record(&calls, "first"))
+		_ = tx.OnRollback(ctx, record(&calls, "second"))
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want %v", err, boom)
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestHooksOnFailedCommit(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectCommit().WillReturnError(errors.New(errors.ErrCodeInternal, "connection lost"))
+
+	var calls []string
+	err := tx.WithinTx(context.Background(), tx.NewUnitOfWord(m), func(ctx context.Context) error {
+		_ = tx.OnCommit(ctx, record(&calls, "commit"))
+		return tx.OnRollback(ctx, record(&calls, "rollback"))
+	})
+	if !errors.Is(err, tx.ErrCommitFailed) {
+		t.Fatalf("err = %v, want ErrCommitFailed", err)
+	}
+	if want := []string{"rollback"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestHooksWithoutTx(t *testing.T) {
+	var calls []string
+	ctx := context.Background()
+	if err := tx.OnCommit(ctx, record(&calls, "commit")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.OnRollback(ctx, record(&calls, "rollback")); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"commit"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestHooksWithoutTxFail(t *testing.T) {
+	u := tx.NewUnitOfWord(pgtest.New(t), tx.WithNoTxHooks(tx.FailHooksWithoutTx))
+	ran := false
+	hook := func(context.Context) { ran = true }
+
+	for name, register := range map[string]func(context.Context, func(context.Context)) error{
+		"OnCommit":   u.OnCommit,
+		"OnRollback": u.OnRollback,
+	} {
+		err := register(context.Background(), hook)
+		if !errors.Is(err, tx.ErrNoTx) {
+			t.Errorf("%s: err = %v, want ErrNoTx", name, err)
+		}
+		if code := errors.GetCode(err); code != errors.ErrCodeFailedPrecondition {
+			t.Errorf("%s: code = %d, want %d", name, code, errors.ErrCodeFailedPrecondition)
+		}
+	}
+	if ran {
+		t.Error("hook ran without a transaction")
+	}
+
+	// The package-level functions are unaffected by the unit's policy.
+	if err := tx.OnCommit(context.Background(), hook); err != nil || !ran {
+		t.Errorf("OnCommit: err = %v, ran = %t", err, ran)
+	}
+}
+
+func TestMemoryTransactorHooksWithoutTxFail(t *testing.T) {
+	m := tx.NewMemoryTransactor(tx.WithNoTxHooks(tx.FailHooksWithoutTx))
+
+	if err := m.OnCommit(context.Background(), func(context.Context) {}); !errors.Is(err, tx.ErrNoTx) {
+		t.Errorf("err = %v, want ErrNoTx", err)
+	}
+
+	var calls []string
+	err := m.Transact(context.Background(), func(ctx context.Context) error {
+		return m.OnCommit(ctx, record(&calls, "commit"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"commit"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestHookPanicDoesNotStopOthers(t *testing.T) {
+	m := tx.NewMemoryTransactor()
+
+	var calls []string
+	err := m.Transact(context.Background(), func(ctx context.Context) error {
+		_ = tx.OnCommit(ctx, func(context.Context) { panic("hook") })
+		return tx.OnCommit(ctx, record(&calls, "after"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"after"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
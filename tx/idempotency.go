@@ -0,0 +1,157 @@
+package tx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nghiatrann0502/kyra-kit/errors"
+)
+
+const _defaultIdempotencyTTL = 24 * time.Hour
+
+// IdempotencySchema creates the table used by WithIdempotency.
+const IdempotencySchema = `
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	key         TEXT PRIMARY KEY,
+	fingerprint TEXT NOT NULL DEFAULT '',
+	result      JSONB NOT NULL DEFAULT 'null',
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+`
+
+// ===== Idempotency =====
+
+type IdempotencyOption func(*idempotencyConfig)
+
+type idempotencyConfig struct {
+	fingerprint string
+	ttl         time.Duration
+	failFast    bool
+}
+
+// Fingerprint identifies the request, e.g. a hash of its body. A call whose
+// key was stored with another fingerprint fails with ErrIdempotencyMismatch.
+func Fingerprint(fp string) IdempotencyOption {
+	return func(c *idempotencyConfig) {
+		c.fingerprint = fp
+	}
+}
+
+// IdempotencyTTL sets how long a stored result is replayed; an older key is
+// treated as new. The default is 24h. WithIdempotency rejects a ttl that is
+// not positive, which would never replay anything.
+func IdempotencyTTL(ttl time.Duration) IdempotencyOption {
+	return func(c *idempotencyConfig) {
+		c.ttl = ttl
+	}
+}
+
+// FailFast makes a call return ErrIdempotencyInProgress instead of waiting
+// while another call with the same key runs.
+func FailFast() IdempotencyOption {
+	return func(c *idempotencyConfig) {
+		c.failFast = true
+	}
+}
+
+// WithIdempotency runs fn at most once per key. The key and the JSON encoded
+// result are stored in the idempotency_keys table in the same transaction as
+// fn's writes, so a repeated call returns the stored result without running
+// fn. A call made while another one with the same key runs waits for it to
+// finish, then replays its result or, if it failed, runs fn itself.
+func WithIdempotency[T any](ctx context.Context, t Transactor, key string, fn func(ctx context.Context) (T, error), opts ...IdempotencyOption) (T, error) {
+	cfg := idempotencyConfig{ttl: _defaultIdempotencyTTL}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var res T
+	if cfg.ttl <= 0 {
+		return res, errors.Newf(errors.ErrCodeInternal, "tx: idempotency TTL must be positive, got %s", cfg.ttl)
+	}
+
+	err := t.Transact(ctx, func(ctx context.Context) error {
+		tx := TxFrom(ctx)
+		if tx == nil {
+			return noTx("WithIdempotency")
+		}
+
+		// The lock serializes calls with the same key until the owner's
+		// transaction ends.
+		if cfg.failFast {
+			var locked bool
+			if err := tx.QueryRow(ctx,
+				"SELECT pg_try_advisory_xact_lock(hashtextextended($1, 0))", key).Scan(&locked); err != nil {
+				return err
+			}
+			if !locked {
+				return idempotencyConflict(ErrIdempotencyInProgress, key)
+			}
+		} else if _, err := tx.Exec(ctx,
+			"SELECT pg_advisory_xact_lock(hashtextextended($1, 0))", key); err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO idempotency_keys (key, fingerprint)
+			VALUES ($1, $2)
+			ON CONFLICT (key) DO UPDATE
+			SET fingerprint = EXCLUDED.fingerprint, result = 'null', created_at = now()
+			WHERE idempotency_keys.created_at < now() - make_interval(secs => $3)`,
+			key, cfg.fingerprint, cfg.ttl.Seconds())
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() == 0 {
+			var fingerprint string
+			var stored []byte
+			if err := tx.QueryRow(ctx,
+				"SELECT fingerprint, result FROM idempotency_keys WHERE key = $1", key).Scan(&fingerprint, &stored); err != nil {
+				return err
+			}
+			if fingerprint != cfg.fingerprint {
+				return idempotencyConflict(ErrIdempotencyMismatch, key)
+			}
+			return json.Unmarshal(stored, &res)
+		}
+
+		r, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+
+		encoded, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("tx: encode idempotent result: %w", err)
+		}
+		if _, err := tx.Exec(ctx,
+			"UPDATE idempotency_keys SET result = $2 WHERE key = $1", key, encoded); err != nil {
+			return err
+		}
+
+		res = r
+		return nil
+	})
+
+	return res, err
+}
+
+// idempotencyConflict reports err as ErrCodeAlreadyExists, i.e. 409
+// Conflict; errors.Is still matches err.
+func idempotencyConflict(err error, key string) error {
+	return errors.Wrap(err, errors.ErrCodeAlreadyExists, fmt.Sprintf("idempotency key %q", key))
+}
+
+// PurgeIdempotencyKeys deletes keys stored more than olderThan ago.
+func PurgeIdempotencyKeys(ctx context.Context, db DBTX, olderThan time.Duration) (int64, error) {
+	tag, err := db.Exec(ctx,
+		"DELETE FROM idempotency_keys WHERE created_at < now() - make_interval(secs => $1)",
+		olderThan.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,103 @@
+package tx_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nghiatrann0502/kyra-kit/errors"
+	"github.com/nghiatrann0502/kyra-kit/postgres/pgtest"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+type charge struct {
+	ID int
+}
+
+func expectLockAndInsert(m *pgtest.Mock, inserted string) {
+	m.ExpectBegin()
+	m.ExpectExecRegexp(`pg_advisory_xact_lock`).WithArgs("key-1")
+	m.ExpectExecRegexp(`INSERT INTO idempotency_keys`).WillReturnResult(inserted)
+}
+
+func TestWithIdempotencyStoresAndReplays(t *testing.T) {
+	m := pgtest.New(t)
+	expectLockAndInsert(m, "INSERT 0 1")
+	m.ExpectExecRegexp(`UPDATE idempotency_keys`).WithArgs("key-1", []byte(`{"ID":5}`))
+	m.ExpectCommit()
+	expectLockAndInsert(m, "INSERT 0 0")
+	m.ExpectQueryRegexp(`SELECT fingerprint, result`).
+		WillReturnRows(pgtest.NewRows("fingerprint", "result").AddRow("fp", []byte(`{"ID":5}`)))
+	m.ExpectCommit()
+
+	u := tx.NewUnitOfWord(m)
+	calls := 0
+	fn := func(context.Context) (charge, error) {
+		calls++
+		return charge{ID: 5}, nil
+	}
+
+	for i := range 2 {
+		got, err := tx.WithIdempotency(context.Background(), u, "key-1", fn, tx.Fingerprint("fp"))
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if got.ID != 5 {
+			t.Errorf("call %d: result = %+v", i, got)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("fn ran %d times, want 1", calls)
+	}
+}
+
+func TestWithIdempotencyFingerprintMismatchIsConflict(t *testing.T) {
+	m := pgtest.New(t)
+	expectLockAndInsert(m, "INSERT 0 0")
+	m.ExpectQueryRegexp(`SELECT fingerprint, result`).
+		WillReturnRows(pgtest.NewRows("fingerprint", "result").AddRow("fp", []byte(`{"ID":5}`)))
+	m.ExpectRollback()
+
+	_, err := tx.WithIdempotency(context.Background(), tx.NewUnitOfWord(m), "key-1",
+		func(context.Context) (charge, error) { return charge{}, nil }, tx.Fingerprint("other"))
+
+	if !errors.Is(err, tx.ErrIdempotencyMismatch) || errors.Is(err, tx.ErrIdempotencyInProgress) {
+		t.Fatalf("err = %v, want ErrIdempotencyMismatch", err)
+	}
+	if code := errors.GetCode(err); code != errors.ErrCodeAlreadyExists {
+		t.Errorf("code = %d, want %d", code, errors.ErrCodeAlreadyExists)
+	}
+}
+
+func TestWithIdempotencyFailFast(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectQueryRegexp(`pg_try_advisory_xact_lock`).
+		WillReturnRows(pgtest.NewRows("locked").AddRow(false))
+	m.ExpectRollback()
+
+	_, err := tx.WithIdempotency(context.Background(), tx.NewUnitOfWord(m), "key-1",
+		func(context.Context) (charge, error) { return charge{}, nil }, tx.FailFast())
+
+	if !errors.Is(err, tx.ErrIdempotencyInProgress) {
+		t.Fatalf("err = %v, want ErrIdempotencyInProgress", err)
+	}
+	if code := errors.GetCode(err); code != errors.ErrCodeAlreadyExists {
+		t.Errorf("code = %d, want %d", code, errors.ErrCodeAlreadyExists)
+	}
+}
+
+func TestWithIdempotencyRejectsNonPositiveTTL(t *testing.T) {
+	m := pgtest.New(t)
+
+	for _, ttl := range []time.Duration{0, -time.Hour} {
+		_, err := tx.WithIdempotency(context.Background(), tx.NewUnitOfWord(m), "key-1",
+			func(context.Context) (charge, error) {
+				t.Error("fn ran")
+				return charge{}, nil
+			}, tx.IdempotencyTTL(ttl))
+		if err == nil {
+			t.Errorf("ttl %s: WithIdempotency succeeded, want error", ttl)
+		}
+	}
+}
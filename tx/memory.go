@@ -0,0 +1,109 @@
+package tx
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// ===== In-memory transactor =====
+
+// MemoryTransactor is a Transactor for unit tests that talks to no database.
+// It follows the propagation options and runs OnCommit and OnRollback
+// callbacks as a real transaction would, and counts the transactions it
+// started, committed and rolled back. TxFrom returns nil inside it, so
+// helpers that run SQL, such as outbox.Add, fail with ErrNoTx.
+type MemoryTransactor struct {
+	opts []Option
+
+	started    atomic.Int64
+	committed  atomic.Int64
+	rolledBack atomic.Int64
+}
+
+var _ Transactor = (*MemoryTransactor)(nil)
+
+func NewMemoryTransactor(opts ...Option) *MemoryTransactor {
+	return &MemoryTransactor{opts: opts}
+}
+
+func (m *MemoryTransactor) Transact(ctx context.Context, fn func(ctx context.Context) error, opts ...Option) (err error) {
+	cfg := newConfig(m.opts, opts)
+	existing := stateFrom(ctx)
+
+	switch cfg.propagation {
+	case Never:
+		if existing != nil {
+			return txExists()
+		}
+		return fn(ctx)
+	case Mandatory:
+		if existing == nil {
+			return noTx("Mandatory propagation")
+		}
+	case RequiresNew:
+		existing = nil
+	}
+
+	if existing != nil {
+		if err := checkJoin(existing.opts, cfg.txOptions); err != nil {
+			return err
+		}
+		if cfg.propagation != Nested {
+			return fn(ctx)
+		}
+
+		mark := existing.hooks.mark()
+		if err := fn(ctx); err != nil {
+			existing.hooks.discard(mark)
+			return err
+		}
+		return nil
+	}
+
+	m.started.Add(1)
+	ctx = withID(ctx, newID())
+	h := &hooks{}
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		if cfg.recoverPanics {
+			if r := recover(); r != nil {
+				err = panicError(r)
+			}
+		}
+		m.rolledBack.Add(1)
+		h.runRollback(ctx)
+	}()
+
+	if err := fn(withTx(ctx, &txState{opts: cfg.txOptions, hooks: h})); err != nil {
+		return err
+	}
+
+	committed = true
+	m.committed.Add(1)
+	h.runCommit(ctx)
+
+	return nil
+}
+
+// Started returns the number of outermost transactions started.
+func (m *MemoryTransactor) Started() int {
+	return int(m.started.Load())
+}
+
+func (m *MemoryTransactor) Committed() int {
+	return int(m.committed.Load())
+}
+
+func (m *MemoryTransactor) RolledBack() int {
+	return int(m.rolledBack.Load())
+}
+
+// Reset zeroes the counters.
+func (m *MemoryTransactor) Reset() {
+	m.started.Store(0)
+	m.committed.Store(0)
+	m.rolledBack.Store(0)
+}
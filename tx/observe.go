@@ -0,0 +1,108 @@
+package tx
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/nghiatrann0502/kyra-kit/logger"
+)
+
+// ===== Instrumentation =====
+
+type ctxKeyTxID struct{}
+
+var logIDOnce sync.Once
+
+// LogID makes logger.ZapHandler log the ID of the transaction in the context
+// as tx_id. Call it once at startup; later calls do nothing.
+func LogID() {
+	logIDOnce.Do(func() {
+		logger.RegisterExtractor("tx_id", func(ctx context.Context) any {
+			if id := ID(ctx); id != "" {
+				return id
+			}
+			return nil
+		})
+	})
+}
+
+// ID returns the short ID of the transaction started by WithinTx, or "" if
+// ctx has none. After LogID it is logged as tx_id by logger.ZapHandler.
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKeyTxID{}).(string)
+	return id
+}
+
+func withID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKeyTxID{}, id)
+}
+
+func newID() string {
+	return fmt.Sprintf("%08x", rand.Uint32())
+}
+
+type Outcome string
+
+const (
+	OutcomeCommitted    Outcome = "committed"
+	OutcomeRolledBack   Outcome = "rolled_back"
+	OutcomeCommitFailed Outcome = "commit_failed"
+)
+
+// Stats describes one finished transaction attempt.
+type Stats struct {
+	ID       string
+	OpenedAt string
+	// Duration runs from BEGIN until COMMIT or ROLLBACK returned.
+	Duration   time.Duration
+	Statements int
+	Outcome    Outcome
+	Err        error
+}
+
+// Observer receives the stats of every transaction a UnitOfWork runs, e.g.
+// to feed a metrics backend. It is called synchronously and must be quick.
+type Observer interface {
+	ObserveTx(ctx context.Context, s Stats)
+}
+
+type ObserverFunc func(ctx context.Context, s Stats)
+
+func (f ObserverFunc) ObserveTx(ctx context.Context, s Stats) {
+	f(ctx, s)
+}
+
+func WithObserver(o Observer) Option {
+	return func(c *config) {
+		c.observer = o
+	}
+}
+
+// WarnAfter logs a warning for every transaction still open after d, naming
+// where it was opened. It is off by default; zero turns it off again.
+func WarnAfter(d time.Duration) Option {
+	return func(c *config) {
+		c.slowThreshold = d
+	}
+}
+
+// watchSlow starts the long-running transaction warning. The returned
+// function cancels it.
+func watchSlow(ctx context.Context, g *guardedTx, threshold time.Duration) func() bool {
+	if threshold <= 0 {
+		return func() bool { return false }
+	}
+
+	timer := time.AfterFunc(threshold, func() {
+		slog.WarnContext(ctx, "tx: long-running transaction",
+			"tx_id", ID(ctx),
+			"opened_at", g.openedAt,
+			"elapsed", threshold,
+			"statements", g.statements.Load())
+	})
+	return timer.Stop
+}
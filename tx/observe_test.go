@@ -0,0 +1,220 @@
+package tx_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nghiatrann0502/kyra-kit/errors"
+	"github.com/nghiatrann0502/kyra-kit/logger"
+	"github.com/nghiatrann0502/kyra-kit/postgres/pgtest"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// observe returns an option recording the stats of every attempt in stats.
+func observe(stats *[]tx.Stats) tx.Option {
+	return tx.WithObserver(tx.ObserverFunc(func(_ context.Context, s tx.Stats) {
+		*stats = append(*stats, s)
+	}))
+}
+
+func TestObserverStats(t *testing.T) {
+	commitErr := errors.New(errors.ErrCodeInternal, "connection lost")
+	tests := []struct {
+		name       string
+		setup      func(m *pgtest.Mock)
+		fnErr      error
+		outcome    tx.Outcome
+		statements int
+	}{
+		{"committed", func(m *pgtest.Mock) {
+			m.ExpectBegin()
+			m.ExpectExec(update)
+			m.ExpectExec(update)
+			m.ExpectCommit()
+		}, nil, tx.OutcomeCommitted, 2},
+		{"rolled back", func(m *pgtest.Mock) {
+			m.ExpectBegin()
+			m.ExpectExec(update)
+			m.ExpectExec(update)
+			m.ExpectRollback()
+		}, fnErr, tx.OutcomeRolledBack, 2},
+		{"commit failed", func(m *pgtest.Mock) {
+			m.ExpectBegin()
+			m.ExpectExec(update)
+			m.ExpectExec(update)
+			m.ExpectCommit().WillReturnError(commitErr)
+		}, nil, tx.OutcomeCommitFailed, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := pgtest.New(t)
+			tt.setup(m)
+
+			var stats []tx.Stats
+			var id string
+			err := tx.WithinTxOpts(context.Background(), tx.NewUnitOfWord(m), func(ctx context.Context) error {
+				id = tx.ID(ctx)
+				if err := exec(ctx); err != nil {
+					return err
+				}
+				if err := exec(ctx); err != nil {
+					return err
+				}
+				return tt.fnErr
+			}, observe(&stats))
+
+			if len(stats) != 1 {
+				t.Fatalf("observed %d transactions, want 1", len(stats))
+			}
+			s := stats[0]
+			if s.ID == "" || s.ID != id {
+				t.Errorf("ID = %q, want the ID seen by fn, %q", s.ID, id)
+			}
+			if !strings.Contains(s.OpenedAt, "TestObserverStats") {
+				t.Errorf("OpenedAt = %q, want the caller", s.OpenedAt)
+			}
+			if s.Outcome != tt.outcome || s.Statements != tt.statements {
+				t.Errorf("outcome = %s, statements = %d; want %s, %d", s.Outcome, s.Statements, tt.outcome, tt.statements)
+			}
+			if s.Duration <= 0 {
+				t.Errorf("Duration = %s, want it measured", s.Duration)
+			}
+			if s.Err != err {
+				t.Errorf("Err = %v, want the returned error %v", s.Err, err)
+			}
+		})
+	}
+}
+
+func TestObserverOncePerAttempt(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectExec(update).WillReturnError(serializationFailure)
+	m.ExpectRollback()
+	m.ExpectBegin()
+	m.ExpectExec(update)
+	m.ExpectCommit()
+
+	var stats []tx.Stats
+	retries := 0
+	opts := append(retrying(2, &retries), observe(&stats))
+	if err := tx.WithinTxOpts(context.Background(), tx.NewUnitOfWord(m), exec, opts...); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[0].Outcome != tx.OutcomeRolledBack || stats[1].Outcome != tx.OutcomeCommitted {
+		t.Errorf("stats = %+v, want a rolled back then a committed attempt", stats)
+	}
+	if stats[0].ID == stats[1].ID {
+		t.Error("both attempts have the same ID")
+	}
+}
+
+// recorder is a slog.Handler that sends every record on a channel.
+type recorder chan slog.Record
+
+func (r recorder) Enabled(context.Context, slog.Level) bool        { return true }
+func (r recorder) Handle(_ context.Context, rec slog.Record) error { r <- rec.Clone(); return nil }
+func (r recorder) WithAttrs([]slog.Attr) slog.Handler              { return r }
+func (r recorder) WithGroup(string) slog.Handler                   { return r }
+
+func captureLogs(t *testing.T) recorder {
+	rec := make(recorder, 16)
+	prev := slog.Default()
+	slog.SetDefault(slog.New(rec))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return rec
+}
+
+func TestWarnAfter(t *testing.T) {
+	rec := captureLogs(t)
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectExec(update)
+	m.ExpectCommit()
+
+	err := tx.WithinTxOpts(context.Background(), tx.NewUnitOfWord(m), func(ctx context.Context) error {
+		if err := exec(ctx); err != nil {
+			return err
+		}
+		select {
+		case r := <-rec:
+			if r.Message != "tx: long-running transaction" {
+				t.Errorf("message = %q", r.Message)
+			}
+			attrs := map[string]slog.Value{}
+			r.Attrs(func(a slog.Attr) bool {
+				attrs[a.Key] = a.Value
+				return true
+			})
+			if attrs["tx_id"].String() != tx.ID(ctx) {
+				t.Errorf("tx_id = %v, want %s", attrs["tx_id"], tx.ID(ctx))
+			}
+			if !strings.Contains(attrs["opened_at"].String(), "TestWarnAfter") {
+				t.Errorf("opened_at = %v, want the caller", attrs["opened_at"])
+			}
+			if attrs["statements"].Int64() != 1 {
+				t.Errorf("statements = %v, want 1", attrs["statements"])
+			}
+		case <-time.After(time.Second):
+			t.Error("no warning for a long-running transaction")
+		}
+		return nil
+	}, tx.WarnAfter(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNoWarningByDefault(t *testing.T) {
+	rec := captureLogs(t)
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectCommit()
+
+	err := tx.WithinTx(context.Background(), tx.NewUnitOfWord(m), func(context.Context) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-rec:
+		t.Errorf("unexpected log %q", r.Message)
+	default:
+	}
+}
+
+func TestLogID(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	log := logger.NewSlogLogger(zap.New(core))
+	tx.LogID()
+	tx.LogID()
+
+	var id string
+	err := tx.NewMemoryTransactor().Transact(context.Background(), func(ctx context.Context) error {
+		id = tx.ID(ctx)
+		log.InfoContext(ctx, "inside")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.InfoContext(context.Background(), "outside")
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("logged %d entries, want 2", len(entries))
+	}
+	if got := entries[0].ContextMap(); len(got) != 1 || got["tx_id"] != id {
+		t.Errorf("inside fields = %v, want only tx_id %s", got, id)
+	}
+	if got := entries[1].ContextMap(); len(got) != 0 {
+		t.Errorf("outside fields = %v, want none", got)
+	}
+}
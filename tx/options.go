@@ -0,0 +1,144 @@
+package tx
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nghiatrann0502/kyra-kit/errors"
+)
+
+// ===== Options =====
+type Option func(*config)
+
+type config struct {
+	txOptions     pgx.TxOptions
+	retry         retryConfig
+	propagation   Propagation
+	recoverPanics bool
+	timeout       time.Duration
+	observer      Observer
+	slowThreshold time.Duration
+	noTxHooks     NoTxHooks
+}
+
+// newConfig applies the unit of work defaults, then the per-call options.
+func newConfig(defaults, opts []Option) config {
+	cfg := config{
+		retry: retryConfig{
+			maxAttempts: 1,
+			baseDelay:   _defaultRetryBaseDelay,
+			maxDelay:    _defaultRetryMaxDelay,
+		},
+	}
+	for _, opt := range defaults {
+		opt(&cfg)
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithTxOptions replaces all pgx transaction options at once.
+func WithTxOptions(opts pgx.TxOptions) Option {
+	return func(c *config) {
+		c.txOptions = opts
+	}
+}
+
+func WithIsoLevel(level pgx.TxIsoLevel) Option {
+	return func(c *config) {
+		c.txOptions.IsoLevel = level
+	}
+}
+
+func Serializable() Option {
+	return WithIsoLevel(pgx.Serializable)
+}
+
+func ReadOnly() Option {
+	return func(c *config) {
+		c.txOptions.AccessMode = pgx.ReadOnly
+	}
+}
+
+func ReadWrite() Option {
+	return func(c *config) {
+		c.txOptions.AccessMode = pgx.ReadWrite
+	}
+}
+
+// Deferrable only has an effect on SERIALIZABLE READ ONLY transactions.
+func Deferrable() Option {
+	return func(c *config) {
+		c.txOptions.DeferrableMode = pgx.Deferrable
+	}
+}
+
+// WithBeginQuery overrides the statement used to start the transaction; the
+// other transaction options are then ignored by pgx.
+func WithBeginQuery(query string) Option {
+	return func(c *config) {
+		c.txOptions.BeginQuery = query
+	}
+}
+
+// WithTimeout bounds each attempt of the transaction, from BEGIN to COMMIT,
+// to d. Statements past the deadline fail and the transaction rolls back.
+// Nested calls that join the transaction cannot change it.
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.timeout = d
+	}
+}
+
+// RecoverPanics turns a panic in fn into an ErrCodeInternal error carrying
+// the panic site's stack, returned after the transaction is rolled back.
+// Without it the panic propagates once the rollback is done.
+func RecoverPanics() Option {
+	return func(c *config) {
+		c.recoverPanics = true
+	}
+}
+
+func isoRank(level pgx.TxIsoLevel) int {
+	switch level {
+	case pgx.RepeatableRead:
+		return 2
+	case pgx.Serializable:
+		return 3
+	default:
+		// Postgres runs READ UNCOMMITTED as READ COMMITTED, its default.
+		return 1
+	}
+}
+
+// checkJoin rejects joining an outer transaction that cannot honour the
+// options the nested call asked for, with an ErrCodeFailedPrecondition error
+// wrapping ErrIncompatibleTx.
+func checkJoin(outer, inner pgx.TxOptions) error {
+	if isoRank(inner.IsoLevel) > isoRank(outer.IsoLevel) {
+		return errors.Wrapf(ErrIncompatibleTx, errors.ErrCodeFailedPrecondition,
+			"nested call wants isolation %q, outer transaction has %q", inner.IsoLevel, isoName(outer.IsoLevel))
+	}
+	if inner.AccessMode == pgx.ReadWrite && outer.AccessMode == pgx.ReadOnly {
+		return errors.Wrap(ErrIncompatibleTx, errors.ErrCodeFailedPrecondition,
+			"nested call wants a read-write transaction, outer transaction is read only")
+	}
+	if inner.DeferrableMode == pgx.Deferrable && outer.DeferrableMode != pgx.Deferrable {
+		return errors.Wrap(ErrIncompatibleTx, errors.ErrCodeFailedPrecondition,
+			"nested call wants a deferrable transaction, outer transaction is not")
+	}
+	if inner.BeginQuery != "" && inner.BeginQuery != outer.BeginQuery {
+		return errors.Wrap(ErrIncompatibleTx, errors.ErrCodeFailedPrecondition,
+			"nested call has its own begin query")
+	}
+	return nil
+}
+
+func isoName(level pgx.TxIsoLevel) pgx.TxIsoLevel {
+	if level == "" {
+		return pgx.ReadCommitted
+	}
+	return level
+}
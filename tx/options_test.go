@@ -0,0 +1,49 @@
+package tx
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nghiatrann0502/kyra-kit/errors"
+)
+
+func TestCheckJoin(t *testing.T) {
+	tests := []struct {
+		name         string
+		outer, inner pgx.TxOptions
+		ok           bool
+	}{
+		{"defaults", pgx.TxOptions{}, pgx.TxOptions{}, true},
+		{"explicit read committed", pgx.TxOptions{}, pgx.TxOptions{IsoLevel: pgx.ReadCommitted}, true},
+		{"read uncommitted is read committed", pgx.TxOptions{}, pgx.TxOptions{IsoLevel: pgx.ReadUncommitted}, true},
+		{"weaker isolation", pgx.TxOptions{IsoLevel: pgx.Serializable}, pgx.TxOptions{IsoLevel: pgx.RepeatableRead}, true},
+		{"same isolation", pgx.TxOptions{IsoLevel: pgx.RepeatableRead}, pgx.TxOptions{IsoLevel: pgx.RepeatableRead}, true},
+		{"stronger isolation", pgx.TxOptions{}, pgx.TxOptions{IsoLevel: pgx.Serializable}, false},
+		{"repeatable read in serializable only", pgx.TxOptions{IsoLevel: pgx.ReadCommitted}, pgx.TxOptions{IsoLevel: pgx.RepeatableRead}, false},
+		{"read only in read write", pgx.TxOptions{}, pgx.TxOptions{AccessMode: pgx.ReadOnly}, true},
+		{"unspecified access in read only", pgx.TxOptions{AccessMode: pgx.ReadOnly}, pgx.TxOptions{}, true},
+		{"read write in read only", pgx.TxOptions{AccessMode: pgx.ReadOnly}, pgx.TxOptions{AccessMode: pgx.ReadWrite}, false},
+		{"deferrable in deferrable", pgx.TxOptions{DeferrableMode: pgx.Deferrable}, pgx.TxOptions{DeferrableMode: pgx.Deferrable}, true},
+		{"deferrable in not deferrable", pgx.TxOptions{}, pgx.TxOptions{DeferrableMode: pgx.Deferrable}, false},
+		{"same begin query", pgx.TxOptions{BeginQuery: "BEGIN"}, pgx.TxOptions{BeginQuery: "BEGIN"}, true},
+		{"no begin query in custom", pgx.TxOptions{BeginQuery: "BEGIN"}, pgx.TxOptions{}, true},
+		{"own begin query", pgx.TxOptions{}, pgx.TxOptions{BeginQuery: "BEGIN ISOLATION LEVEL SERIALIZABLE"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkJoin(tt.outer, tt.inner)
+			if tt.ok {
+				if err != nil {
+					t.Errorf("checkJoin = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrIncompatibleTx) {
+				t.Fatalf("checkJoin = %v, want ErrIncompatibleTx", err)
+			}
+			if code := errors.GetCode(err); code != errors.ErrCodeFailedPrecondition {
+				t.Errorf("code = %d, want %d", code, errors.ErrCodeFailedPrecondition)
+			}
+		})
+	}
+}
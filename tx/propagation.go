@@ -0,0 +1,103 @@
+package tx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nghiatrann0502/kyra-kit/errors"
+)
+
+// ===== Propagation =====
+
+// Propagation decides how WithinTx relates to a transaction already in the
+// context.
+type Propagation int
+
+const (
+	// Required joins the active transaction or starts a new one. Default.
+	Required Propagation = iota
+	// RequiresNew always starts an independent transaction on another
+	// connection. The outer transaction, if any, stays open meanwhile, so
+	// each level holds a pool connection.
+	RequiresNew
+	// Nested runs fn under a SAVEPOINT of the active transaction and rolls
+	// back to it if fn fails, leaving the outer transaction usable. Without
+	// an active transaction it behaves like Required.
+	Nested
+	// Mandatory joins the active transaction and fails with ErrNoTx if
+	// there is none.
+	Mandatory
+	// Never runs fn without a transaction and fails with ErrTxExists if
+	// one is active.
+	Never
+)
+
+func (p Propagation) String() string {
+	switch p {
+	case Required:
+		return "required"
+	case RequiresNew:
+		return "requires_new"
+	case Nested:
+		return "nested"
+	case Mandatory:
+		return "mandatory"
+	case Never:
+		return "never"
+	default:
+		return fmt.Sprintf("propagation(%d)", int(p))
+	}
+}
+
+func WithPropagation(p Propagation) Option {
+	return func(c *config) {
+		c.propagation = p
+	}
+}
+
+// runSavepoint runs fn under a savepoint of the transaction in s.
+func runSavepoint(ctx context.Context, s *txState, fn func(ctx context.Context) error) (err error) {
+	// A MemoryTransactor's transaction has nothing to put a savepoint on.
+	if s.tx == nil {
+		return noTx("a savepoint")
+	}
+
+	sp, err := s.tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	guarded := newGuardedTx(sp, s.statements)
+	mark := s.hooks.mark()
+	released := false
+	defer func() {
+		guarded.finish()
+		if !released {
+			err = withRollbackError(err, sp.Rollback(context.WithoutCancel(ctx)))
+			s.hooks.discard(mark)
+		}
+	}()
+
+	if err := fn(withTx(ctx, &txState{tx: guarded, opts: s.opts, hooks: s.hooks, statements: s.statements})); err != nil {
+		return err
+	}
+
+	if err := sp.Commit(ctx); err != nil {
+		return err
+	}
+	released = true
+
+	return nil
+}
+
+// noTx reports that what needs a transaction ctx does not carry, as an
+// ErrCodeFailedPrecondition error wrapping ErrNoTx.
+func noTx(what string) error {
+	return errors.Wrap(ErrNoTx, errors.ErrCodeFailedPrecondition, what+" needs a transaction")
+}
+
+// txExists reports a Never call inside a transaction, as an
+// ErrCodeFailedPrecondition error wrapping ErrTxExists.
+func txExists() error {
+	return errors.Wrap(ErrTxExists, errors.ErrCodeFailedPrecondition, "Never propagation inside a transaction")
+}
@@ -0,0 +1,170 @@
+package tx_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nghiatrann0502/kyra-kit/errors"
+	"github.com/nghiatrann0502/kyra-kit/postgres/pgtest"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+func TestNestedRollsBackToSavepoint(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectExec("INSERT INTO orders VALUES (1)")
+	m.ExpectBegin() // savepoint
+	m.ExpectExec("INSERT INTO audit VALUES (1)").WillReturnError(errors.New(errors.ErrCodeInternal, "audit full"))
+	m.ExpectRollback() // to the savepoint
+	m.ExpectExec("INSERT INTO orders VALUES (2)")
+	m.ExpectCommit()
+
+	var hooks []string
+	u := tx.NewUnitOfWord(m)
+	err := tx.WithinTx(context.Background(), u, func(ctx context.Context) error {
+		outer := tx.TxFrom(ctx)
+		if _, err := outer.Exec(ctx, "INSERT INTO orders VALUES (1)"); err != nil {
+			return err
+		}
+		tx.OnCommit(ctx, func(context.Context) { hooks = append(hooks, "outer") })
+
+		nestedErr := tx.WithinTxOpts(ctx, u, func(ctx context.Context) error {
+			tx.OnCommit(ctx, func(context.Context) { hooks = append(hooks, "inner") })
+			_, err := tx.TxFrom(ctx).Exec(ctx, "INSERT INTO audit VALUES (1)")
+			return err
+		}, tx.WithPropagation(tx.Nested))
+		if nestedErr == nil {
+			return errors.New(errors.ErrCodeInternal, "nested call succeeded")
+		}
+
+		_, err := outer.Exec(ctx, "INSERT INTO orders VALUES (2)")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks) != 1 || hooks[0] != "outer" {
+		t.Errorf("hooks = %v, want [outer]", hooks)
+	}
+}
+
+func TestNestedReleasesSavepoint(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectBegin()
+	m.ExpectExec("INSERT INTO audit VALUES (1)")
+	m.ExpectCommit() // RELEASE SAVEPOINT
+	m.ExpectCommit()
+
+	var hooks []string
+	u := tx.NewUnitOfWord(m)
+	err := tx.WithinTx(context.Background(), u, func(ctx context.Context) error {
+		return tx.WithinTxOpts(ctx, u, func(ctx context.Context) error {
+			tx.OnCommit(ctx, func(context.Context) { hooks = append(hooks, "inner") })
+			_, err := tx.TxFrom(ctx).Exec(ctx, "INSERT INTO audit VALUES (1)")
+			return err
+		}, tx.WithPropagation(tx.Nested))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks) != 1 {
+		t.Errorf("hooks = %v, want [inner]", hooks)
+	}
+}
+
+func TestRequiresNewUsesSeparateTx(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectBegin()
+	m.ExpectCommit() // inner
+	m.ExpectRollback()
+
+	u := tx.NewUnitOfWord(m)
+	boom := errors.New(errors.ErrCodeInternal, "boom")
+	err := tx.WithinTx(context.Background(), u, func(ctx context.Context) error {
+		outer := tx.TxFrom(ctx)
+		err := tx.WithinTxOpts(ctx, u, func(ctx context.Context) error {
+			if tx.TxFrom(ctx) == outer {
+				t.Error("RequiresNew joined the outer transaction")
+			}
+			return nil
+		}, tx.WithPropagation(tx.RequiresNew))
+		if err != nil {
+			return err
+		}
+		// The inner transaction stays committed.
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want %v", err, boom)
+	}
+}
+
+func TestMandatoryWithoutTx(t *testing.T) {
+	m := pgtest.New(t)
+
+	err := tx.WithinTxOpts(context.Background(), tx.NewUnitOfWord(m), func(context.Context) error {
+		t.Error("fn ran")
+		return nil
+	}, tx.WithPropagation(tx.Mandatory))
+	if !errors.Is(err, tx.ErrNoTx) {
+		t.Errorf("err = %v, want ErrNoTx", err)
+	}
+	if code := errors.GetCode(err); code != errors.ErrCodeFailedPrecondition {
+		t.Errorf("code = %d, want %d", code, errors.ErrCodeFailedPrecondition)
+	}
+}
+
+func TestMandatoryJoins(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectCommit()
+
+	u := tx.NewUnitOfWord(m)
+	err := tx.WithinTx(context.Background(), u, func(ctx context.Context) error {
+		outer := tx.TxFrom(ctx)
+		return tx.WithinTxOpts(ctx, u, func(ctx context.Context) error {
+			if tx.TxFrom(ctx) != outer {
+				t.Error("Mandatory did not join the outer transaction")
+			}
+			return nil
+		}, tx.WithPropagation(tx.Mandatory))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNeverInsideTx(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectRollback()
+
+	u := tx.NewUnitOfWord(m)
+	err := tx.WithinTx(context.Background(), u, func(ctx context.Context) error {
+		return tx.WithinTxOpts(ctx, u, func(context.Context) error {
+			t.Error("fn ran")
+			return nil
+		}, tx.WithPropagation(tx.Never))
+	})
+	if !errors.Is(err, tx.ErrTxExists) {
+		t.Errorf("err = %v, want ErrTxExists", err)
+	}
+	if code := errors.GetCode(err); code != errors.ErrCodeFailedPrecondition {
+		t.Errorf("code = %d, want %d", code, errors.ErrCodeFailedPrecondition)
+	}
+}
+
+func TestNeverWithoutTx(t *testing.T) {
+	m := pgtest.New(t)
+
+	ran := false
+	err := tx.WithinTxOpts(context.Background(), tx.NewUnitOfWord(m), func(ctx context.Context) error {
+		ran = tx.TxFrom(ctx) == nil
+		return nil
+	}, tx.WithPropagation(tx.Never))
+	if err != nil || !ran {
+		t.Errorf("err = %v, ran without tx = %t", err, ran)
+	}
+}
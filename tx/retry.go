@@ -0,0 +1,97 @@
+package tx
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nghiatrann0502/kyra-kit/errors"
+)
+
+const (
+	_defaultRetryBaseDelay = 10 * time.Millisecond
+	_defaultRetryMaxDelay  = time.Second
+)
+
+// ===== Retry =====
+type retryConfig struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	onRetry     func(ctx context.Context, attempt int, err error)
+}
+
+// WithRetry reruns the whole transaction, up to maxAttempts times in total,
+// when it fails with a serialization failure (40001) or a deadlock (40P01).
+// Only the outermost WithinTx retries; fn must be safe to run again.
+// maxAttempts must be at least 1.
+func WithRetry(maxAttempts int) Option {
+	return func(c *config) {
+		c.retry.maxAttempts = maxAttempts
+	}
+}
+
+// WithRetryBackoff sets the delay before the first retry, doubled on each
+// following one up to max, with full jitter.
+func WithRetryBackoff(base, max time.Duration) Option {
+	return func(c *config) {
+		c.retry.baseDelay = base
+		c.retry.maxDelay = max
+	}
+}
+
+// OnRetry is called before every retry with the attempt that failed.
+func OnRetry(fn func(ctx context.Context, attempt int, err error)) Option {
+	return func(c *config) {
+		c.retry.onRetry = fn
+	}
+}
+
+// IsRetryable reports whether err is a serialization failure or deadlock,
+// i.e. the transaction can succeed if run again from the start.
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == "40001" || pgErr.Code == "40P01"
+}
+
+func (r retryConfig) validate() error {
+	if r.maxAttempts < 1 {
+		return errors.Newf(errors.ErrCodeInternal, "tx: WithRetry needs at least 1 attempt, got %d", r.maxAttempts)
+	}
+	return nil
+}
+
+func (r retryConfig) delay(attempt int) time.Duration {
+	d := r.baseDelay
+	for i := 1; i < attempt && d < r.maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, r.maxDelay)
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d + 1)
+}
+
+func withRetry(ctx context.Context, r retryConfig, run func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := run()
+		if err == nil || attempt >= r.maxAttempts || !IsRetryable(err) {
+			return err
+		}
+
+		if r.onRetry != nil {
+			r.onRetry(ctx, attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(r.delay(attempt)):
+		}
+	}
+}
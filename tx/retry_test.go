@@ -0,0 +1,143 @@
+package tx_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/nghiatrann0502/kyra-kit/postgres/pgtest"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+const update = "UPDATE accounts SET balance = balance - 1"
+
+var serializationFailure = &pgconn.PgError{Code: "40001", Message: "could not serialize access"}
+
+func exec(ctx context.Context) error {
+	_, err := tx.TxFrom(ctx).Exec(ctx, update)
+	return err
+}
+
+func retrying(attempts int, retries *int) []tx.Option {
+	return []tx.Option{
+		tx.WithRetry(attempts),
+		tx.WithRetryBackoff(0, 0),
+		tx.OnRetry(func(context.Context, int, error) { *retries++ }),
+	}
+}
+
+func TestRetryRerunsFn(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectExec(update).WillReturnError(serializationFailure)
+	m.ExpectRollback()
+	m.ExpectBegin()
+	m.ExpectExec(update)
+	m.ExpectCommit()
+
+	calls, retries := 0, 0
+	err := tx.WithinTxOpts(context.Background(), tx.NewUnitOfWord(m), func(ctx context.Context) error {
+		calls++
+		return exec(ctx)
+	}, retrying(3, &retries)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || retries != 1 {
+		t.Errorf("calls = %d, retries = %d; want 2, 1", calls, retries)
+	}
+}
+
+func TestRetryAfterFailedCommit(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectExec(update)
+	m.ExpectCommit().WillReturnError(serializationFailure)
+	m.ExpectBegin()
+	m.ExpectExec(update)
+	m.ExpectCommit()
+
+	calls, retries := 0, 0
+	err := tx.WithinTxOpts(context.Background(), tx.NewUnitOfWord(m), func(ctx context.Context) error {
+		calls++
+		return exec(ctx)
+	}, retrying(3, &retries)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || retries != 1 {
+		t.Errorf("calls = %d, retries = %d; want 2, 1", calls, retries)
+	}
+}
+
+func TestRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	m := pgtest.New(t)
+	for range 2 {
+		m.ExpectBegin()
+		m.ExpectExec(update).WillReturnError(serializationFailure)
+		m.ExpectRollback()
+	}
+
+	calls, retries := 0, 0
+	err := tx.WithinTxOpts(context.Background(), tx.NewUnitOfWord(m), func(ctx context.Context) error {
+		calls++
+		return exec(ctx)
+	}, retrying(2, &retries)...)
+	if !tx.IsRetryable(err) {
+		t.Fatalf("err = %v, want the serialization failure", err)
+	}
+	if calls != 2 || retries != 1 {
+		t.Errorf("calls = %d, retries = %d; want 2, 1", calls, retries)
+	}
+}
+
+func TestRetrySkipsOtherErrors(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectExec(update).WillReturnError(&pgconn.PgError{Code: "23505"})
+	m.ExpectRollback()
+
+	calls, retries := 0, 0
+	err := tx.WithinTxOpts(context.Background(), tx.NewUnitOfWord(m), func(ctx context.Context) error {
+		calls++
+		return exec(ctx)
+	}, retrying(3, &retries)...)
+	if err == nil || calls != 1 || retries != 0 {
+		t.Errorf("err = %v, calls = %d, retries = %d; want an error after 1 call", err, calls, retries)
+	}
+}
+
+func TestRetryNotAttemptedInJoinedTx(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectExec(update).WillReturnError(serializationFailure)
+	m.ExpectRollback()
+
+	u := tx.NewUnitOfWord(m)
+	calls, retries := 0, 0
+	err := tx.WithinTx(context.Background(), u, func(ctx context.Context) error {
+		return tx.WithinTxOpts(ctx, u, func(ctx context.Context) error {
+			calls++
+			return exec(ctx)
+		}, retrying(3, &retries)...)
+	})
+	if !errors.Is(err, serializationFailure) {
+		t.Fatalf("err = %v, want the serialization failure", err)
+	}
+	if calls != 1 || retries != 0 {
+		t.Errorf("calls = %d, retries = %d; want 1, 0", calls, retries)
+	}
+}
+
+func TestWithRetryRejectsZeroAttempts(t *testing.T) {
+	m := pgtest.New(t)
+
+	err := tx.WithinTxOpts(context.Background(), tx.NewUnitOfWord(m), func(context.Context) error {
+		t.Error("fn ran")
+		return nil
+	}, tx.WithRetry(0))
+	if err == nil {
+		t.Error("WithinTxOpts succeeded, want error")
+	}
+}
@@ -0,0 +1,14 @@
+package twophase
+
+import "errors"
+
+var (
+	// ErrAborted is returned, with ErrCodeAborted, when Recover aborted the
+	// transaction between PREPARE and the commit decision. It was rolled back
+	// everywhere.
+	ErrAborted = errors.New("twophase: transaction aborted by recovery")
+	// ErrInDoubt is returned, with ErrCodeUnavailable, when the outcome could
+	// not be applied on every participant. The prepared transactions stay
+	// until Recover finishes them according to the decision log.
+	ErrInDoubt = errors.New("twophase: transaction in doubt")
+)
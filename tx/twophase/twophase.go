@@ -0,0 +1,291 @@
+// Package twophase coordinates one transaction across several Postgres
+// databases with two-phase commit (PREPARE TRANSACTION / COMMIT PREPARED).
+//
+// Guarantees: once Run returns nil, fn's writes are committed on every
+// participant. If Run fails before the commit decision is logged, they are
+// rolled back everywhere. In between, a crash or lost connection leaves
+// prepared transactions behind that hold their locks until Recover resolves
+// them from the decision log: committed if a commit decision was logged,
+// rolled back otherwise (presumed abort). Run Recover at startup and
+// periodically.
+//
+// Requirements: every participant needs max_prepared_transactions > 0, and
+// the decision log lives in its own database, which should be one of the
+// participants or at least as durable. Statements inside fn do not see each
+// other across databases, and tx hooks, savepoints and retries do not apply.
+package twophase
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nghiatrann0502/kyra-kit/errors"
+	"github.com/nghiatrann0502/kyra-kit/postgres"
+)
+
+const (
+	_defaultGIDPrefix    = "kyra2pc"
+	_defaultRecoverAfter = time.Minute
+)
+
+// Schema creates the decision log; it belongs in the coordinator's database.
+const Schema = `
+CREATE TABLE IF NOT EXISTS twophase_decisions (
+	gid          TEXT PRIMARY KEY,
+	decision     TEXT NOT NULL,
+	participants TEXT[] NOT NULL,
+	created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+`
+
+const (
+	decisionCommit = "commit"
+	decisionAbort  = "abort"
+)
+
+type Participant struct {
+	Name string
+	DB   postgres.DBEngine
+}
+
+type Option func(*Coordinator)
+
+// GIDPrefix sets the prefix of the prepared transaction IDs. Recover only
+// touches IDs with its own prefix, so coordinators with separate decision
+// logs on the same database need different prefixes.
+func GIDPrefix(prefix string) Option {
+	return func(c *Coordinator) {
+		c.prefix = prefix
+	}
+}
+
+// RecoverAfter sets how old a prepared transaction must be before Recover
+// touches it, so that transactions still being committed by a live
+// coordinator are left alone. The default is one minute.
+func RecoverAfter(d time.Duration) Option {
+	return func(c *Coordinator) {
+		c.recoverAfter = d
+	}
+}
+
+type Coordinator struct {
+	log          postgres.DBEngine
+	participants []Participant
+	prefix       string
+	recoverAfter time.Duration
+}
+
+// New returns a coordinator that logs its decisions in log.
+func New(log postgres.DBEngine, participants []Participant, opts ...Option) (*Coordinator, error) {
+	if len(participants) == 0 {
+		return nil, fmt.Errorf("twophase: at least one participant is required")
+	}
+	seen := make(map[string]bool, len(participants))
+	for _, p := range participants {
+		if p.Name == "" || p.DB == nil {
+			return nil, fmt.Errorf("twophase: participant needs a name and a database")
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("twophase: duplicate participant %q", p.Name)
+		}
+		seen[p.Name] = true
+	}
+
+	c := &Coordinator{
+		log:          log,
+		participants: participants,
+		prefix:       _defaultGIDPrefix,
+		recoverAfter: _defaultRecoverAfter,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.recoverAfter <= 0 {
+		return nil, fmt.Errorf("twophase: recover after must be positive, got %s", c.recoverAfter)
+	}
+
+	return c, nil
+}
+
+type ctxKeyTxs struct{}
+
+// TxOn returns the transaction on the named participant inside Run, or nil.
+func TxOn(ctx context.Context, name string) pgx.Tx {
+	txs, _ := ctx.Value(ctxKeyTxs{}).(map[string]pgx.Tx)
+	return txs[name]
+}
+
+// Run begins a transaction on every participant, runs fn, and commits them
+// all with two-phase commit. fn reaches the transactions through TxOn.
+func (c *Coordinator) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	gid := fmt.Sprintf("%s_%016x", c.prefix, rand.Uint64())
+	cleanup := context.WithoutCancel(ctx)
+
+	txs := make(map[string]pgx.Tx, len(c.participants))
+	rollbackOpen := func() {
+		for _, t := range txs {
+			_ = t.Rollback(cleanup)
+		}
+	}
+	for _, p := range c.participants {
+		t, err := p.DB.BeginTx(ctx, pgx.TxOptions{})
+		if err != nil {
+			rollbackOpen()
+			return fmt.Errorf("twophase: begin on %s: %w", p.Name, err)
+		}
+		txs[p.Name] = t
+	}
+
+	if err := fn(context.WithValue(ctx, ctxKeyTxs{}, txs)); err != nil {
+		rollbackOpen()
+		return err
+	}
+
+	// Phase one: after PREPARE the transaction outlives its session. The
+	// COMMIT that follows only releases the connection.
+	var prepared []Participant
+	for _, p := range c.participants {
+		t := txs[p.Name]
+		if _, err := t.Exec(ctx, "PREPARE TRANSACTION "+quote(gid)); err != nil {
+			rollbackOpen()
+			c.resolve(cleanup, gid, prepared, decisionAbort)
+			return fmt.Errorf("twophase: prepare on %s: %w", p.Name, err)
+		}
+		_ = t.Commit(ctx)
+		prepared = append(prepared, p)
+	}
+
+	// The decision is durable once this returns; Recover follows it.
+	decision, err := c.decide(ctx, gid, decisionCommit)
+	if err != nil {
+		return outcome(errors.ErrCodeUnavailable, gid, fmt.Errorf("%w: log decision: %w", ErrInDoubt, err))
+	}
+	if decision != decisionCommit {
+		c.resolve(cleanup, gid, prepared, decisionAbort)
+		return outcome(errors.ErrCodeAborted, gid, ErrAborted)
+	}
+
+	// Phase two.
+	if err := c.resolve(cleanup, gid, prepared, decisionCommit); err != nil {
+		return outcome(errors.ErrCodeUnavailable, gid, fmt.Errorf("%w: %w", ErrInDoubt, err))
+	}
+	c.forget(cleanup, gid)
+
+	return nil
+}
+
+// outcome reports err, which wraps ErrAborted or ErrInDoubt, under code so
+// that errors.HTTPStatus does not treat it as an internal error.
+func outcome(code errors.ErrorCode, gid string, err error) error {
+	return errors.Wrap(err, code, "twophase transaction "+gid)
+}
+
+// Recover resolves prepared transactions left behind by crashed
+// coordinators: those with a commit decision are committed, all others are
+// rolled back.
+func (c *Coordinator) Recover(ctx context.Context) error {
+	pending := make(map[string][]Participant)
+	var errs []error
+	for _, p := range c.participants {
+		gids, err := c.prepared(ctx, p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("twophase: list prepared on %s: %w", p.Name, err))
+			continue
+		}
+		for _, gid := range gids {
+			pending[gid] = append(pending[gid], p)
+		}
+	}
+
+	for _, gid := range slices.Sorted(maps.Keys(pending)) {
+		ps := pending[gid]
+		// Logging an abort first stops a late coordinator from committing.
+		decision, err := c.decide(ctx, gid, decisionAbort)
+		if err == nil {
+			err = c.resolve(ctx, gid, ps, decision)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("twophase: recover %s: %w", gid, err))
+			continue
+		}
+		slog.InfoContext(ctx, "twophase: recovered prepared transaction", "gid", gid, "decision", decision)
+	}
+
+	// Unless every participant was reached and resolved, an old decision
+	// may still be needed.
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	_, err := c.log.Exec(ctx,
+		"DELETE FROM twophase_decisions WHERE created_at < now() - make_interval(secs => $1)",
+		c.recoverAfter.Seconds())
+	return err
+}
+
+func (c *Coordinator) prepared(ctx context.Context, p Participant) ([]string, error) {
+	rows, err := p.DB.Query(ctx, `
+		SELECT gid FROM pg_prepared_xacts
+		WHERE database = current_database()
+			AND starts_with(gid, $1)
+			AND prepared < now() - make_interval(secs => $2)`,
+		c.prefix+"_", c.recoverAfter.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// decide records decision for gid unless one exists, and returns the one in
+// effect.
+func (c *Coordinator) decide(ctx context.Context, gid, decision string) (string, error) {
+	names := make([]string, len(c.participants))
+	for i, p := range c.participants {
+		names[i] = p.Name
+	}
+
+	var current string
+	err := c.log.QueryRow(ctx, `
+		INSERT INTO twophase_decisions (gid, decision, participants)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (gid) DO UPDATE SET gid = EXCLUDED.gid
+		RETURNING decision`,
+		gid, decision, names).Scan(&current)
+	return current, err
+}
+
+func (c *Coordinator) forget(ctx context.Context, gid string) {
+	if _, err := c.log.Exec(ctx, "DELETE FROM twophase_decisions WHERE gid = $1", gid); err != nil {
+		slog.WarnContext(ctx, "twophase: delete decision failed", "gid", gid, "error", err)
+	}
+}
+
+// resolve commits or rolls back the prepared transaction gid on ps.
+func (c *Coordinator) resolve(ctx context.Context, gid string, ps []Participant, decision string) error {
+	stmt := "ROLLBACK PREPARED "
+	if decision == decisionCommit {
+		stmt = "COMMIT PREPARED "
+	}
+
+	var errs []error
+	for _, p := range ps {
+		if _, err := p.DB.Exec(ctx, stmt+quote(gid)); err != nil {
+			slog.ErrorContext(ctx, "twophase: resolve prepared transaction failed",
+				"gid", gid, "participant", p.Name, "decision", decision, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// quote makes a string literal; PREPARE TRANSACTION takes no parameters.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
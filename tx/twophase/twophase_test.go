@@ -0,0 +1,199 @@
+package twophase
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nghiatrann0502/kyra-kit/errors"
+	"github.com/nghiatrann0502/kyra-kit/postgres/pgtest"
+)
+
+const (
+	prepareSQL   = `^PREPARE TRANSACTION 'kyra2pc_[0-9a-f]{16}'$`
+	decideSQL    = `INSERT INTO twophase_decisions`
+	commitSQL    = `^COMMIT PREPARED 'kyra2pc_[0-9a-f]{16}'$`
+	rollbackSQL  = `^ROLLBACK PREPARED 'kyra2pc_[0-9a-f]{16}'$`
+	forgetSQL    = `DELETE FROM twophase_decisions WHERE gid = \$1`
+	preparedSQL  = `FROM pg_prepared_xacts`
+	purgeSQL     = `DELETE FROM twophase_decisions WHERE created_at`
+	insertOrders = "INSERT INTO orders VALUES (1)"
+)
+
+type cluster struct {
+	log, a, b *pgtest.Mock
+	c         *Coordinator
+}
+
+func newCluster(t *testing.T) *cluster {
+	t.Helper()
+	cl := &cluster{log: pgtest.New(t), a: pgtest.New(t), b: pgtest.New(t)}
+	c, err := New(cl.log, []Participant{{Name: "a", DB: cl.a}, {Name: "b", DB: cl.b}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.c = c
+	return cl
+}
+
+func decision(d string) *pgtest.Rows {
+	return pgtest.NewRows("decision").AddRow(d)
+}
+
+func (cl *cluster) expectWork() {
+	cl.a.ExpectBegin()
+	cl.b.ExpectBegin()
+	cl.a.ExpectExec(insertOrders)
+}
+
+func (cl *cluster) expectPrepared(ms ...*pgtest.Mock) {
+	for _, m := range ms {
+		m.ExpectExecRegexp(prepareSQL)
+		m.ExpectCommit()
+	}
+}
+
+func work(ctx context.Context) error {
+	_, err := TxOn(ctx, "a").Exec(ctx, insertOrders)
+	return err
+}
+
+func TestNewValidates(t *testing.T) {
+	db := pgtest.New(t)
+	tests := map[string]struct {
+		ps   []Participant
+		opts []Option
+	}{
+		"no participants":     {nil, nil},
+		"unnamed participant": {[]Participant{{DB: db}}, nil},
+		"duplicate":           {[]Participant{{"a", db}, {"a", db}}, nil},
+		"zero recover after":  {[]Participant{{"a", db}}, []Option{RecoverAfter(0)}},
+	}
+	for name, tt := range tests {
+		if _, err := New(db, tt.ps, tt.opts...); err == nil {
+			t.Errorf("%s: New succeeded, want error", name)
+		}
+	}
+}
+
+func TestRunCommitsEverywhere(t *testing.T) {
+	cl := newCluster(t)
+	cl.expectWork()
+	cl.expectPrepared(cl.a, cl.b)
+	cl.log.ExpectQueryRegexp(decideSQL).
+		WithArgs(pgtest.AnyArg(), "commit", []string{"a", "b"}).
+		WillReturnRows(decision("commit"))
+	cl.a.ExpectExecRegexp(commitSQL)
+	cl.b.ExpectExecRegexp(commitSQL)
+	cl.log.ExpectExecRegexp(forgetSQL)
+
+	if err := cl.c.Run(context.Background(), work); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunAbortsWhenPrepareFails(t *testing.T) {
+	cl := newCluster(t)
+	cl.expectWork()
+	cl.expectPrepared(cl.a)
+	cl.b.ExpectExecRegexp(prepareSQL).WillReturnError(errors.New(errors.ErrCodeDatabase, "disk full"))
+	cl.b.ExpectRollback()
+	cl.a.ExpectExecRegexp(rollbackSQL)
+
+	err := cl.c.Run(context.Background(), work)
+	if err == nil || errors.Is(err, ErrInDoubt) {
+		t.Fatalf("Run = %v, want a prepare error", err)
+	}
+}
+
+func TestRunInDoubtWhenDecisionNotLogged(t *testing.T) {
+	cl := newCluster(t)
+	cl.expectWork()
+	cl.expectPrepared(cl.a, cl.b)
+	cl.log.ExpectQueryRegexp(decideSQL).WillReturnError(errors.New(errors.ErrCodeDatabase, "conn lost"))
+
+	err := cl.c.Run(context.Background(), work)
+	if !errors.Is(err, ErrInDoubt) {
+		t.Fatalf("Run = %v, want ErrInDoubt", err)
+	}
+	if got := errors.HTTPStatus(err); got != http.StatusServiceUnavailable {
+		t.Errorf("HTTPStatus = %d, want %d", got, http.StatusServiceUnavailable)
+	}
+}
+
+func TestRunInDoubtWhenCommitPreparedFails(t *testing.T) {
+	cl := newCluster(t)
+	cl.expectWork()
+	cl.expectPrepared(cl.a, cl.b)
+	cl.log.ExpectQueryRegexp(decideSQL).WillReturnRows(decision("commit"))
+	cl.a.ExpectExecRegexp(commitSQL)
+	cl.b.ExpectExecRegexp(commitSQL).WillReturnError(errors.New(errors.ErrCodeDatabase, "conn lost"))
+	// The decision is kept for Recover.
+
+	err := cl.c.Run(context.Background(), work)
+	if !errors.Is(err, ErrInDoubt) {
+		t.Fatalf("Run = %v, want ErrInDoubt", err)
+	}
+}
+
+func TestRunAbortedByRecovery(t *testing.T) {
+	cl := newCluster(t)
+	cl.expectWork()
+	cl.expectPrepared(cl.a, cl.b)
+	cl.log.ExpectQueryRegexp(decideSQL).WillReturnRows(decision("abort"))
+	cl.a.ExpectExecRegexp(rollbackSQL)
+	cl.b.ExpectExecRegexp(rollbackSQL)
+
+	err := cl.c.Run(context.Background(), work)
+	if !errors.Is(err, ErrAborted) {
+		t.Fatalf("Run = %v, want ErrAborted", err)
+	}
+	if got := errors.HTTPStatus(err); got != http.StatusConflict {
+		t.Errorf("HTTPStatus = %d, want %d", got, http.StatusConflict)
+	}
+}
+
+func TestRunRollsBackWhenFnFails(t *testing.T) {
+	cl := newCluster(t)
+	cl.a.ExpectBegin()
+	cl.b.ExpectBegin()
+	cl.a.ExpectRollback()
+	cl.b.ExpectRollback()
+
+	boom := errors.New(errors.ErrCodeInvalidInput, "bad order")
+	if err := cl.c.Run(context.Background(), func(context.Context) error { return boom }); !errors.Is(err, boom) {
+		t.Errorf("Run = %v, want %v", err, boom)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	cl := newCluster(t)
+	cl.a.ExpectQueryRegexp(preparedSQL).
+		WithArgs("kyra2pc_", time.Minute.Seconds()).
+		WillReturnRows(pgtest.NewRows("gid").AddRow("kyra2pc_1").AddRow("kyra2pc_2"))
+	cl.b.ExpectQueryRegexp(preparedSQL).
+		WillReturnRows(pgtest.NewRows("gid").AddRow("kyra2pc_1"))
+
+	// kyra2pc_1 had logged a commit; kyra2pc_2 had not and is aborted.
+	cl.log.ExpectQueryRegexp(decideSQL).WithArgs("kyra2pc_1", "abort", pgtest.AnyArg()).WillReturnRows(decision("commit"))
+	cl.a.ExpectExec("COMMIT PREPARED 'kyra2pc_1'")
+	cl.b.ExpectExec("COMMIT PREPARED 'kyra2pc_1'")
+	cl.log.ExpectQueryRegexp(decideSQL).WithArgs("kyra2pc_2", "abort", pgtest.AnyArg()).WillReturnRows(decision("abort"))
+	cl.a.ExpectExec("ROLLBACK PREPARED 'kyra2pc_2'")
+	cl.log.ExpectExecRegexp(purgeSQL).WithArgs(time.Minute.Seconds())
+
+	if err := cl.c.Recover(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecoverKeepsDecisionsAfterFailure(t *testing.T) {
+	cl := newCluster(t)
+	cl.a.ExpectQueryRegexp(preparedSQL).WillReturnError(errors.New(errors.ErrCodeDatabase, "conn lost"))
+	cl.b.ExpectQueryRegexp(preparedSQL).WillReturnRows(pgtest.NewRows("gid"))
+
+	if err := cl.c.Recover(context.Background()); err == nil {
+		t.Fatal("Recover succeeded, want the listing error")
+	}
+}
@@ -2,25 +2,71 @@ package tx
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/nghiatrann0502/kyra-kit/postgres"
 )
 
+var (
+	// ErrNoTx is returned, as an ErrCodeFailedPrecondition error, by
+	// Mandatory propagation, Notify and other helpers that need a
+	// transaction when the context carries none.
+	ErrNoTx = errors.New("tx: no transaction in context")
+	// ErrIncompatibleTx is returned, as an ErrCodeFailedPrecondition error,
+	// when a nested call asks for stricter transaction options than the
+	// outer transaction it would join.
+	ErrIncompatibleTx = errors.New("tx: incompatible with outer transaction")
+	// ErrTxExists is returned, as an ErrCodeFailedPrecondition error, for
+	// Never propagation inside a transaction.
+	ErrTxExists = errors.New("tx: transaction already in context")
+	// ErrCommitFailed marks a failed COMMIT. Unless Postgres reported why,
+	// e.g. the connection broke, the transaction may or may not have been
+	// committed.
+	ErrCommitFailed = errors.New("tx: commit failed")
+	// ErrTxFinished is returned for statements run on a transaction after
+	// WithinTx has committed or rolled it back.
+	ErrTxFinished = errors.New("tx: transaction already finished")
+	// ErrIdempotencyMismatch is returned, as an ErrCodeAlreadyExists error,
+	// when a key is reused for a request with another fingerprint.
+	ErrIdempotencyMismatch = errors.New("tx: idempotency key reused with a different request")
+	// ErrIdempotencyInProgress is returned, as an ErrCodeAlreadyExists error,
+	// with FailFast while another call with the same key is running.
+	ErrIdempotencyInProgress = errors.New("tx: idempotency key in use by a concurrent request")
+)
+
 // ===== Context key =====
 type ctxKeyTx struct{}
 
+// txState is what the context carries for an active transaction.
+type txState struct {
+	tx         pgx.Tx
+	opts       pgx.TxOptions
+	hooks      *hooks
+	statements *atomic.Int64
+}
+
+func stateFrom(ctx context.Context) *txState {
+	if s, ok := ctx.Value(ctxKeyTx{}).(*txState); ok {
+		return s
+	}
+
+	return nil
+}
+
 func TxFrom(ctx context.Context) pgx.Tx {
-	if tx, ok := ctx.Value(ctxKeyTx{}).(pgx.Tx); ok {
-		return tx
+	if s := stateFrom(ctx); s != nil {
+		return s.tx
 	}
 
 	return nil
 }
 
-func withTx(ctx context.Context, tx pgx.Tx) context.Context {
-	return context.WithValue(ctx, ctxKeyTx{}, tx)
+func withTx(ctx context.Context, s *txState) context.Context {
+	return context.WithValue(ctx, ctxKeyTx{}, s)
 }
 
 type DBTX interface {
@@ -29,51 +75,190 @@ type DBTX interface {
 	QueryRow(context.Context, string, ...any) pgx.Row
 }
 
+// FromCtxOr returns the transaction in ctx, else the connection held by
+// WithConn, else fallback.
 func FromCtxOr(ctx context.Context, fallback DBTX) DBTX {
 	if tx := TxFrom(ctx); tx != nil {
 		return tx
 	}
+	if conn := ConnFrom(ctx); conn != nil {
+		return conn
+	}
 	return fallback
 }
 
-// ===== Implement =====
-type UnitOfWork struct{ db postgres.DBEngine }
+// ===== Transactor =====
 
-func NewUnitOfWord(db postgres.DBEngine) *UnitOfWork {
-	return &UnitOfWork{db: db}
+// Transactor runs fn in a transaction, joining the one already in ctx
+// according to the propagation option. The package helpers accept any
+// Transactor, so services can depend on it and be tested with a
+// MemoryTransactor.
+type Transactor interface {
+	Transact(ctx context.Context, fn func(ctx context.Context) error, opts ...Option) error
 }
 
-func WithinTx(ctx context.Context, u *UnitOfWork, fn func(ctx context.Context) error) error {
-	_, err := WithinTxR(ctx, u, func(ctx context.Context) (struct{}, error) {
-		return struct{}{}, fn(ctx)
-	})
+func WithinTx(ctx context.Context, t Transactor, fn func(ctx context.Context) error) error {
+	return t.Transact(ctx, fn)
+}
 
-	return err
+func WithinTxR[T any](ctx context.Context, t Transactor, fn func(ctx context.Context) (T, error)) (T, error) {
+	return WithinTxROpts(ctx, t, fn)
+}
+
+// WithinTxOpts is WithinTx with transaction options such as isolation level
+// or read-only mode.
+func WithinTxOpts(ctx context.Context, t Transactor, fn func(ctx context.Context) error, opts ...Option) error {
+	return t.Transact(ctx, fn, opts...)
+}
+
+// WithinTxROpts is WithinTxR with transaction options.
+func WithinTxROpts[T any](ctx context.Context, t Transactor, fn func(ctx context.Context) (T, error), opts ...Option) (T, error) {
+	var res T
+	err := t.Transact(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = fn(ctx)
+		return err
+	}, opts...)
+
+	return res, err
+}
+
+// ===== Implement =====
+type UnitOfWork struct {
+	db   postgres.DBEngine
+	opts []Option
 }
 
-func WithinTxR[T any](ctx context.Context, u *UnitOfWork, fn func(ctx context.Context) (T, error)) (T, error) {
-	if existing := TxFrom(ctx); existing != nil {
+var _ Transactor = (*UnitOfWork)(nil)
+
+// NewUnitOfWord returns a unit of work on db. opts are defaults for every
+// transaction it starts; per-call options override them.
+func NewUnitOfWord(db postgres.DBEngine, opts ...Option) *UnitOfWork {
+	return &UnitOfWork{db: db, opts: opts}
+}
+
+// Transact implements Transactor. With the default Required propagation a
+// nested call joins the outer transaction, or fails with ErrIncompatibleTx
+// if the outer one cannot provide the requested options.
+func (u *UnitOfWork) Transact(ctx context.Context, fn func(ctx context.Context) error, opts ...Option) error {
+	cfg := newConfig(u.opts, opts)
+	if err := cfg.retry.validate(); err != nil {
+		return err
+	}
+	existing := stateFrom(ctx)
+
+	switch cfg.propagation {
+	case Never:
+		if existing != nil {
+			return txExists()
+		}
+		return fn(ctx)
+	case Mandatory:
+		if existing == nil {
+			return noTx("Mandatory propagation")
+		}
+	case RequiresNew:
+		existing = nil
+	}
+
+	if existing != nil {
+		if err := checkJoin(existing.opts, cfg.txOptions); err != nil {
+			return err
+		}
+		if cfg.propagation == Nested {
+			return runSavepoint(ctx, existing, fn)
+		}
 		return fn(ctx)
 	}
 
-	tx, err := u.db.GetDB().Begin(ctx)
+	return withRetry(ctx, cfg.retry, func() error {
+		return runTx(ctx, u, cfg, fn)
+	})
+}
+
+// runTx runs fn in a new transaction and commits it if fn succeeds.
+func runTx(ctx context.Context, u *UnitOfWork, cfg config, fn func(ctx context.Context) error) (err error) {
+	ctx = withID(ctx, newID())
+
+	// Hooks get ctx; the transaction itself runs under txCtx.
+	txCtx := ctx
+	if cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		txCtx, cancel = context.WithTimeout(ctx, cfg.timeout)
+		defer cancel()
+	}
+
+	// Count statements per transaction unless the caller already does.
+	txCtx, _ = postgres.WithQueryStats(txCtx)
+
+	started := time.Now()
+	// Settings are applied with SET LOCAL below, not by the pool hooks.
+	tx, err := beginTx(postgres.WithoutSettings(txCtx), u.db, cfg.txOptions)
 	if err != nil {
-		var zero T
-		return zero, err
+		return err
 	}
 
+	statements := new(atomic.Int64)
+	guarded := newGuardedTx(tx, statements)
+	defer watchSlow(ctx, guarded, cfg.slowThreshold)()
+
+	h := &hooks{}
+	outcome := OutcomeRolledBack
+	var duration time.Duration
 	defer func() {
-		_ = tx.Rollback(ctx)
+		if outcome != OutcomeCommitted {
+			if cfg.recoverPanics {
+				if r := recover(); r != nil {
+					err = panicError(r)
+				}
+			}
+			err = withRollbackError(err, tx.Rollback(context.WithoutCancel(ctx)))
+			duration = time.Since(started)
+			guarded.finish()
+			h.runRollback(ctx)
+		}
+
+		if cfg.observer != nil {
+			cfg.observer.ObserveTx(ctx, Stats{
+				ID:         ID(ctx),
+				OpenedAt:   guarded.openedAt,
+				Duration:   duration,
+				Statements: int(statements.Load()),
+				Outcome:    outcome,
+				Err:        err,
+			})
+		}
 	}()
 
-	res, err := fn(withTx(ctx, tx))
-	if err != nil {
-		return res, err
+	if err := postgres.ApplySettings(txCtx, tx, postgres.SettingsFrom(ctx), true); err != nil {
+		return err
+	}
+
+	state := &txState{tx: guarded, opts: cfg.txOptions, hooks: h, statements: statements}
+	if err := fn(withTx(txCtx, state)); err != nil {
+		return err
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		return res, err
+	if err := tx.Commit(txCtx); err != nil {
+		outcome = OutcomeCommitFailed
+		return commitError(err)
 	}
+	outcome = OutcomeCommitted
+	duration = time.Since(started)
+	guarded.finish()
+	h.runCommit(ctx)
 
-	return res, nil
+	return nil
+}
+
+// Notify queues a notification on the transaction in ctx. Postgres delivers
+// it to listeners only if the transaction commits.
+func Notify(ctx context.Context, channel, payload string) error {
+	tx := TxFrom(ctx)
+	if tx == nil {
+		return noTx("Notify")
+	}
+
+	_, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", channel, payload)
+	return err
 }
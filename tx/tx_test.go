@@ -0,0 +1,36 @@
+package tx_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nghiatrann0502/kyra-kit/errors"
+	"github.com/nghiatrann0502/kyra-kit/postgres/pgtest"
+	"github.com/nghiatrann0502/kyra-kit/tx"
+)
+
+func TestNotifyInsideTx(t *testing.T) {
+	m := pgtest.New(t)
+	m.ExpectBegin()
+	m.ExpectExec("SELECT pg_notify($1, $2)").WithArgs("orders", "42")
+	m.ExpectCommit()
+
+	err := tx.WithinTx(context.Background(), tx.NewUnitOfWord(m), func(ctx context.Context) error {
+		return tx.Notify(ctx, "orders", "42")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotifyWithoutTx(t *testing.T) {
+	pgtest.New(t)
+
+	err := tx.Notify(context.Background(), "orders", "42")
+	if !errors.Is(err, tx.ErrNoTx) {
+		t.Errorf("err = %v, want ErrNoTx", err)
+	}
+	if code := errors.GetCode(err); code != errors.ErrCodeFailedPrecondition {
+		t.Errorf("code = %d, want %d", code, errors.ErrCodeFailedPrecondition)
+	}
+}